@@ -10,10 +10,20 @@ import (
 	"gopkg.in/natefinch/lumberjack.v2"
 )
 
+const (
+	modeBackup       = "backup"
+	modeCheckVolumes = "check-volumes"
+	modeDecrypt      = "decrypt"
+	modeReplicate    = "replicate"
+)
+
 var (
 	errRequiredArguments    = errors.New("required arguments are not filled")
 	errConfigFile           = errors.New("config file is not exists")
 	errNotDefinedConfigFile = errors.New("does not define config file")
+	errUnexpectedMode       = errors.New("unexpected mode")
+	errNotDefinedDecryption = errors.New("identity, source and output are required for decrypting")
+	errNotDefinedReplica    = errors.New("task, from and to are required for replication")
 )
 
 type cliSetting struct {
@@ -21,6 +31,14 @@ type cliSetting struct {
 	showHelp    bool
 	loggerPath  string
 	environment string
+	mode        string
+	identity    string
+	source      string
+	volume      string
+	outputPath  string
+	task        string
+	from        string
+	to          string
 	logOut      io.WriteCloser
 }
 
@@ -37,6 +55,31 @@ func (c *cliSetting) Init() {
 	pflag.StringVarP(&c.environment, "env", "e",
 		"local",
 		"kind of environment running. Log level and format depend on this")
+	pflag.StringVarP(&c.mode, "mode", "m",
+		modeBackup,
+		"Mode of running: 'backup' executes tasks, 'check-volumes' checks that every volume is writable, 'decrypt' decrypts backup, "+
+			"'replicate' copies backups of task from volume to volume")
+	pflag.StringVarP(&c.identity, "identity", "i",
+		"",
+		"File with secret keys of age for decrypting. It is used in mode 'decrypt'")
+	pflag.StringVarP(&c.source, "source", "s",
+		"",
+		"Path of encrypted backup (as it is in report). It is used in mode 'decrypt'")
+	pflag.StringVarP(&c.volume, "volume", "",
+		"",
+		"Id of volume which backup is read from. If is not filled then source is local file. It is used in mode 'decrypt'")
+	pflag.StringVarP(&c.outputPath, "output", "o",
+		"",
+		"Path of decrypted file. It is used in mode 'decrypt'")
+	pflag.StringVarP(&c.task, "task", "t",
+		"",
+		"Id of task which backups are replicated. It is used in mode 'replicate'")
+	pflag.StringVarP(&c.from, "from", "",
+		"",
+		"Id of volume which backups are copied from. It is used in mode 'replicate'")
+	pflag.StringVarP(&c.to, "to", "",
+		"",
+		"Id of volume which backups are copied to. It is used in mode 'replicate'")
 	pflag.Parse()
 }
 
@@ -61,6 +104,19 @@ func (c *cliSetting) checkArgs() error {
 	if c.configPath == "" {
 		return errNotDefinedConfigFile
 	}
+	switch c.mode {
+	case modeBackup, modeCheckVolumes:
+	case modeDecrypt:
+		if c.identity == "" || c.source == "" || c.outputPath == "" {
+			return errNotDefinedDecryption
+		}
+	case modeReplicate:
+		if c.task == "" || c.from == "" || c.to == "" {
+			return errNotDefinedReplica
+		}
+	default:
+		return errUnexpectedMode
+	}
 	return nil
 }
 
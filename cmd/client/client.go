@@ -1,6 +1,5 @@
 package main
 
-//FIXME errors with smb. I think it is connected with netword quality, need to try to do write thought attemps and checking connection
 //TODO save plan to restore
 //TODO need to create json configuration for each other task and each other day. With help this check existing copies and use this for restoring data
 
@@ -9,6 +8,8 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"strings"
+	"text/tabwriter"
 	"time"
 
 	"errors"
@@ -33,14 +34,18 @@ func main() {
 	}
 	defer setting.close()
 
-	startApplication(setting)
+	switch setting.mode {
+	case modeCheckVolumes:
+		checkVolumes(setting)
+	case modeDecrypt:
+		decrypt(setting)
+	case modeReplicate:
+		replicate(setting)
+	default:
+		startApplication(setting)
+	}
 }
 
-/*
-PROBLEMS
-
-	FIXME 1. on linux system does not remove old backup on yandex cloud
-*/
 func startApplication(setting cliSetting) {
 	var (
 		conf s.ProcessConfig
@@ -84,6 +89,98 @@ func startApplication(setting cliSetting) {
 	}
 }
 
+// checkVolumes writes, lists, reads and removes probe on every volume and prints results
+func checkVolumes(setting cliSetting) {
+	logger.Init(setting.environment, setting.output())
+
+	conf, err := s.NewProcessConfig(setting.configPath)
+	if err != nil {
+		logger.Error("could not read config file", "error", err)
+		os.Exit(2)
+	}
+
+	checks, err := p.CheckVolumes(conf)
+	if err != nil {
+		logger.Error("could not check volumes", "error", err)
+		os.Exit(3)
+	}
+
+	healthy := true
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "VOLUME\tLATENCY\tSTATUS\tERROR")
+	for _, c := range checks {
+		status, details := "ok", ""
+		if !c.Healthy() {
+			healthy = false
+			status, details = "failed", strings.ReplaceAll(c.Err.Error(), "\n", "; ")
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", c.Id, c.Latency.Round(time.Millisecond), status, details)
+	}
+	w.Flush()
+
+	if !healthy {
+		os.Exit(5)
+	}
+}
+
+// decrypt reads encrypted backup from volume or local file and saves decrypted content to output
+func decrypt(setting cliSetting) {
+	logger.Init(setting.environment, setting.output())
+
+	conf, err := s.NewProcessConfig(setting.configPath)
+	if err != nil {
+		logger.Error("could not read config file", "error", err)
+		os.Exit(2)
+	}
+
+	fd, err := os.Create(setting.outputPath)
+	if err != nil {
+		logger.Error("could not create output file", "path", setting.outputPath, "error", err)
+		os.Exit(3)
+	}
+	defer fd.Close()
+
+	if err := p.Decrypt(conf, setting.volume, setting.source, setting.identity, fd); err != nil {
+		fd.Close()
+		os.Remove(setting.outputPath)
+		logger.Error("could not decrypt backup", "source", setting.source, "error", err)
+		os.Exit(6)
+	}
+	logger.Info("backup was decrypted", "source", setting.source, "output", setting.outputPath)
+}
+
+// replicate copies backups of task between volumes and prints copied files
+func replicate(setting cliSetting) {
+	logger.Init(setting.environment, setting.output())
+
+	conf, err := s.NewProcessConfig(setting.configPath)
+	if err != nil {
+		logger.Error("could not read config file", "error", err)
+		os.Exit(2)
+	}
+
+	replicas, err := p.Replicate(conf, setting.task, setting.from, setting.to)
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "PATH\tSIZE\tSTATUS\tERROR")
+	for _, r := range replicas {
+		status, details := "copied", ""
+		switch {
+		case r.Err != nil:
+			status, details = "failed", strings.ReplaceAll(r.Err.Error(), "\n", "; ")
+		case r.Skipped:
+			status = "skipped"
+		}
+		fmt.Fprintf(w, "%s\t%d\t%s\t%s\n", r.Path, r.Size, status, details)
+	}
+	w.Flush()
+
+	if err != nil {
+		logger.Error("replication failed", "task", setting.task, "error", err)
+		os.Exit(7)
+	}
+}
+
 func saveReport(stat *p.ProcessStat, reportDate time.Time) (err error) {
 	var (
 		buffer []byte
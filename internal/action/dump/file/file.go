@@ -1,8 +1,8 @@
 package file
 
 import (
-	"bytes"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
 	"regexp"
@@ -11,9 +11,8 @@ import (
 	"errors"
 
 	"github.com/vilasle/backilli/pkg/fs"
-	"github.com/vilasle/backilli/pkg/fs/manager/local"
-	"github.com/vilasle/backilli/pkg/fs/unit"
 	"github.com/vilasle/backilli/pkg/logger"
+	"github.com/vilasle/backilli/pkg/progress"
 )
 
 type FilesTree map[string]FilesTree
@@ -26,6 +25,8 @@ type Dump struct {
 	SourceSize      int64
 	DestinationSize int64
 	Compress        bool
+	// Job - name of job in progress events
+	Job string
 }
 
 func NewDump(src string, dst string, includeRegexp *regexp.Regexp, excludeRegexp *regexp.Regexp, compress bool) Dump {
@@ -65,7 +66,7 @@ func (d *Dump) Dump() error {
 		workDirectory = filepath.Dir(d.PathDestination)
 	}
 
-	c := local.NewClient(unit.ClientConfig{Root: workDirectory})
+	tracker := progress.Start(d.Job, progress.StageDump, "", d.SourceSize)
 
 	logger.Debug("start copping", "files", files)
 	for i := range files {
@@ -86,24 +87,24 @@ func (d *Dump) Dump() error {
 		}
 
 		ft := strings.Join(rf[len(r):], string(filepath.Separator))
-		content, err := os.ReadFile(files[i])
-		if err != nil {
+		if err := copyFile(tracker, files[i], fs.GetFullPath("", workDirectory, ft)); err != nil {
 			return err
 		}
-
-		buf := bytes.NewBuffer(content)
-		if _, err := c.Write(buf, ft); err != nil {
-			return errors.Join(err, fmt.Errorf("does not write file '%s'", ft))
-		}
 	}
+	tracker.Finish()
 	logger.Debug("finish copping", "files", files)
 
 	if d.Compress {
 		logger.Debug("start compressing", "directory", workDirectory)
 		var bck string
-		if bck, err = fs.CompressDir(workDirectory, d.PathDestination); err != nil {
+		tracker := progress.Start(d.Job, progress.StageCompress, "", 0)
+		stop := tracker.Watch(func() int64 { return fs.PartsSize(workDirectory + ".zip") })
+		bck, err = fs.CompressDir(workDirectory, d.PathDestination)
+		stop()
+		if err != nil {
 			return errors.Join(err, fmt.Errorf("compressing failed"))
 		}
+		tracker.Finish()
 		d.PathDestination = bck
 
 		logger.Debug("finish compressing", "destFile", bck)
@@ -138,6 +139,27 @@ func (d *Dump) Dump() error {
 	return err
 }
 
+// copyFile stages file in transitory catalog, staged files are archived or sent to volumes later,
+// so they are not synced to disk one by one
+func copyFile(tracker *progress.Tracker, src string, dst string) error {
+	rd, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer rd.Close()
+
+	wd, err := os.Create(dst)
+	if err != nil {
+		return errors.Join(err, fmt.Errorf("does not create file '%s'", dst))
+	}
+	defer wd.Close()
+
+	if _, err := io.Copy(wd, tracker.Reader(rd)); err != nil {
+		return errors.Join(err, fmt.Errorf("does not write file '%s'", dst))
+	}
+	return wd.Close()
+}
+
 func (d Dump) getFilesForBackup(path string, tree FilesTree) (files []string, err error) {
 	for k, v := range tree {
 		if v != nil {
@@ -159,6 +181,23 @@ func (d Dump) getFilesForBackup(path string, tree FilesTree) (files []string, er
 	return
 }
 
+// EstimateSize returns size of files which match for backup, it is known before copying
+func (d Dump) EstimateSize() (int64, error) {
+	tree, err := generateFilesTree(d.PathSource)
+	if err != nil {
+		return 0, errors.Join(err, errors.New("generate tree files"))
+	}
+
+	files, err := d.getFilesForBackup(d.PathSource, tree)
+	if err != nil {
+		return 0, errors.Join(err, errors.New("checking files for backup"))
+	}
+
+	est := Dump{}
+	est.setEntitySize(files)
+	return est.SourceSize, nil
+}
+
 func (e *Dump) setEntitySize(files []string) error {
 	for i := range files {
 		if stat, err := os.Stat(files[i]); err == nil {
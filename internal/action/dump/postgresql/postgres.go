@@ -15,6 +15,7 @@ import (
 	"github.com/vilasle/backilli/pkg/fs/environment"
 	"github.com/vilasle/backilli/pkg/fs/executing"
 	"github.com/vilasle/backilli/pkg/logger"
+	"github.com/vilasle/backilli/pkg/progress"
 )
 
 var (
@@ -29,6 +30,8 @@ type Dump struct {
 	SourceSize      int64
 	DestinationSize int64
 	manager.ConnectionConfig
+	// Job - name of job in progress events
+	Job    string
 	stdout bytes.Buffer
 	stderr bytes.Buffer
 }
@@ -87,10 +90,14 @@ func (d *Dump) Dump() (err error) {
 
 	logger.Debug("start logical dumping", "exe", PGDUMP, "args", args)
 
+	tracker := progress.Start(d.Job, progress.StageDump, "", 0)
+	stop := tracker.Watch(func() int64 { return fs.DirSize(logicalBackupPath) })
 	err = executing.Execute(PGDUMP, &d.stdout, &d.stderr, args...)
+	stop()
 	if err != nil {
 		return fmt.Errorf(d.stderr.String(), err)
 	}
+	tracker.Finish()
 
 	if err := d.checkLogs(); err != nil {
 		return err
@@ -120,10 +127,14 @@ func (d *Dump) Dump() (err error) {
 
 	if d.Compress {
 		logger.Debug("start compressing", "directory", workDirectory)
+		tracker := progress.Start(d.Job, progress.StageCompress, "", 0)
+		stop := tracker.Watch(func() int64 { return fs.PartsSize(workDirectory + ".zip") })
 		bck, err := fs.CompressDir(workDirectory, d.PathDestination)
+		stop()
 		if err != nil {
 			return err
 		}
+		tracker.Finish()
 		d.PathDestination = bck
 
 		logger.Debug("finish compressing", "destFile", bck)
@@ -183,6 +194,11 @@ func (d *Dump) checkLogs() error {
 	return nil
 }
 
+// EstimateSize returns size of database, it is known before dumping
+func (d Dump) EstimateSize() (int64, error) {
+	return manager.DatabaseSize(d.ConnectionConfig)
+}
+
 func (d *Dump) setSourceSize() error {
 	if size, err := manager.DatabaseSize(d.ConnectionConfig); err == nil {
 		d.SourceSize = size
@@ -1,12 +1,15 @@
 package process
 
 import (
+	"errors"
 	"fmt"
 	"os"
+	"slices"
 
 	"github.com/vilasle/backilli/internal/database"
 	"github.com/vilasle/backilli/internal/entity"
 	"github.com/vilasle/backilli/internal/period"
+	"github.com/vilasle/backilli/internal/tool/encrypt"
 	env "github.com/vilasle/backilli/pkg/fs/environment"
 	"github.com/vilasle/backilli/pkg/fs/manager"
 	"gopkg.in/yaml.v2"
@@ -16,6 +19,12 @@ const (
 	LocalVolume         = "local"
 	SMBVolume           = "smb"
 	YandexStorageVolume = "yandex.storage"
+	S3Volume            = "s3"
+	SFTPVolume          = "sftp"
+	FTPVolume           = "ftp"
+	WebDAVVolume        = "webdav"
+	MemoryVolume        = "memory"
+	CommandVolume       = "command"
 )
 
 const (
@@ -30,18 +39,74 @@ type Catalogs struct {
 }
 
 type VolumeConfig struct {
-	Id         string `yaml:"id"`
-	Type       string `yaml:"type"`
-	Address    string `yaml:"address"`
-	Domain     string `yaml:"domain"`
-	User       string `yaml:"user"`
-	Password   string `yaml:"password"`
-	MountPoint string `yaml:"mountpoint"`
-	KeyId      string `yaml:"key_id"`
-	KeySecret  string `yaml:"key_secret"`
-	BucketName string `yaml:"bucket_name"`
-	Root       string `yaml:"root"`
-	Region     string `yaml:"region"`
+	Id                 string            `yaml:"id"`
+	Type               string            `yaml:"type"`
+	Address            string            `yaml:"address"`
+	Domain             string            `yaml:"domain"`
+	User               string            `yaml:"user"`
+	Password           string            `yaml:"password"`
+	MountPoint         string            `yaml:"mountpoint"`
+	KeyId              string            `yaml:"key_id"`
+	KeySecret          string            `yaml:"key_secret"`
+	BucketName         string            `yaml:"bucket_name"`
+	Root               string            `yaml:"root"`
+	Region             string            `yaml:"region"`
+	Endpoint           string            `yaml:"endpoint"`
+	PathStyle          bool              `yaml:"path_style"`
+	InsecureSkipVerify bool              `yaml:"insecure_skip_verify"`
+	PrivateKey         string            `yaml:"private_key"`
+	Passphrase         string            `yaml:"passphrase"`
+	KnownHosts         string            `yaml:"known_hosts"`
+	TLSMode            string            `yaml:"tls"`
+	DisableEPSV        bool              `yaml:"disable_epsv"`
+	Retry              Retry             `yaml:"retry"`
+	MaxBandwidth       string            `yaml:"max_bandwidth"`
+	BandwidthSchedule  []BandwidthWindow `yaml:"bandwidth_schedule"`
+	Quota              string            `yaml:"quota"`
+	StorageClass       string            `yaml:"storage_class"`
+	SSE                SSE               `yaml:"sse"`
+	ObjectLockMode     string            `yaml:"object_lock_mode"`
+	Commands           Commands          `yaml:"commands"`
+}
+
+// Commands - templates of commands of volume with type "command", for example
+//
+//	write: rclone rcat gdrive:{path}
+//	read: rclone cat gdrive:{path}
+//	ls: rclone lsjson gdrive:{path}
+//	remove: rclone purge gdrive:{path}
+//	not_exist_codes: [3]
+type Commands struct {
+	Write         string `yaml:"write"`
+	Read          string `yaml:"read"`
+	Ls            string `yaml:"ls"`
+	Remove        string `yaml:"remove"`
+	NotExistCodes []int  `yaml:"not_exist_codes"`
+}
+
+// SSE - server-side encryption of objects on S3 volumes. Type is AES256 or aws:kms,
+// KMSKeyId is used with aws:kms only, default key of account is used when it is empty
+type SSE struct {
+	Type     string `yaml:"type"`
+	KMSKeyId string `yaml:"kms_key_id"`
+}
+
+// BandwidthWindow - limit of speed which is applied from time of day till time of day ("18:00", "23:30").
+// Limits (here and max_bandwidth of volume) are bytes per second with optional unit, for example "512KB", "10MB".
+// Empty or zero limit means unlimited speed
+type BandwidthWindow struct {
+	From  string `yaml:"from"`
+	To    string `yaml:"to"`
+	Limit string `yaml:"limit"`
+}
+
+// Retry - policy of repeating failed operations of volume.
+// Delays are durations like "500ms", "1s", "1m"
+type Retry struct {
+	Attempts int     `yaml:"attempts"`
+	Delay    string  `yaml:"delay"`
+	MaxDelay string  `yaml:"max_delay"`
+	Jitter   float64 `yaml:"jitter"`
 }
 
 type Tool struct {
@@ -64,6 +129,57 @@ type Task struct {
 	Compress    bool         `yaml:"compress"`
 	Volumes     []string     `yaml:"volumes"`
 	KeepCopies  int          `yaml:"keepCopies"`
+	Encryption  Encryption   `yaml:"encryption"`
+	// PathTemplate - layout of backups on volumes, for example "{task}/{date:2006-01-02}/{time}/{oid}/{file}".
+	// Default layout is "{task}/{date:02-01-2006}/{oid}/{file}". Layout has to contain {oid}, {file} and {date} or {time}
+	PathTemplate string `yaml:"path_template"`
+	// Repository - backups are split into chunks which are stored once on volume ("repository" directory),
+	// every run saves snapshot which refers to chunks. Compressing should be disabled for better deduplication
+	Repository bool `yaml:"repository"`
+	// Retention - settings of keeping copies on volume of task which override settings of task, for example
+	//
+	//	keepCopies: 3
+	//	retention:
+	//	  cloud:
+	//	    keepCopies: 60
+	Retention map[string]VolumeRetention `yaml:"retention"`
+	// WritePolicy - "all" (default) backup has to be written to every volume, "quorum N" - to N volumes at least,
+	// "first-available" - backup is written to one volume. Order of Volumes is order of failover: the first volume
+	// is primary, every next volume is used when backup was not written to previous ones
+	WritePolicy string `yaml:"write_policy"`
+	// Tiering - copies are moved from volumes of task to colder volume when they become old, for example
+	//
+	//	tiering:
+	//	  after: 7d
+	//	  move_to: cloud
+	Tiering Tiering `yaml:"tiering"`
+}
+
+// Tiering - age of copies ("7d", "2w", "36h") after which they are moved to volume with id MoveTo.
+// Retention of task can define keepCopies for volume MoveTo, copies are not removed from it otherwise
+type Tiering struct {
+	After  string `yaml:"after"`
+	MoveTo string `yaml:"move_to"`
+}
+
+func (t Tiering) Enabled() bool {
+	return t.MoveTo != ""
+}
+
+// VolumeRetention - settings of keeping copies on volume, settings which are not defined are taken from task
+type VolumeRetention struct {
+	KeepCopies *int `yaml:"keepCopies"`
+}
+
+// Encryption - public keys of age (age1...) which backups of task are encrypted for.
+// Keys are listed in recipients or in file (one per line). Backups are not encrypted without keys
+type Encryption struct {
+	Recipients     []string `yaml:"recipients"`
+	RecipientsFile string   `yaml:"recipients_file"`
+}
+
+func (e Encryption) Enabled() bool {
+	return len(e.Recipients) > 0 || e.RecipientsFile != ""
 }
 
 type FileConfig struct {
@@ -80,6 +196,21 @@ type ProcessConfig struct {
 	ExternalTools    Tool           `yaml:"external_tool"`
 	Tasks            []Task         `yaml:"tasks"`
 	Events           `yaml:"events"`
+	// Preflight - check volumes before running tasks. Backup is not written to unhealthy volumes, task is skipped
+	// if its write policy can not be satisfied without them
+	Preflight bool `yaml:"preflight"`
+	// Uploads - limits of concurrent uploads of backups
+	Uploads Uploads `yaml:"uploads"`
+	// ProgressInterval - how often progress of dumping, compressing and uploading is logged ("30s", "1m").
+	// It is 30s if it is not defined, "0" disables progress events
+	ProgressInterval string `yaml:"progress_interval"`
+}
+
+// Uploads - max_concurrent is common limit for all volumes (unlimited if it is not defined),
+// max_per_volume is limit for every volume (4 if it is not defined)
+type Uploads struct {
+	MaxConcurrent int `yaml:"max_concurrent"`
+	MaxPerVolume  int `yaml:"max_per_volume"`
 }
 
 type DatabaseManager struct {
@@ -163,10 +294,42 @@ func CreateBuilderConfigFromTask(
 	config := make([]entity.BuilderConfig, 0)
 
 	main := entity.BuilderConfig{
-		Id:         task.Id,
-		FsManagers: volumes,
-		Compress:   task.Compress,
-		Keep:       task.KeepCopies,
+		Id:           task.Id,
+		FsManagers:   volumes,
+		Compress:     task.Compress,
+		Keep:         task.KeepCopies,
+		PathTemplate: task.PathTemplate,
+		Repository:   task.Repository,
+		WritePolicy:  task.WritePolicy,
+	}
+
+	for id, r := range task.Retention {
+		if !slices.Contains(task.Volumes, id) && id != task.Tiering.MoveTo {
+			return nil, fmt.Errorf("retention is defined for volume %s which is not used by task %s", id, task.Id)
+		}
+		if r.KeepCopies != nil {
+			if main.KeepPerVolume == nil {
+				main.KeepPerVolume = make(map[string]int)
+			}
+			main.KeepPerVolume[id] = *r.KeepCopies
+		}
+	}
+
+	if task.Tiering.Enabled() && task.Repository {
+		return nil, fmt.Errorf("tiering is not supported by repository of task %s", task.Id)
+	}
+
+	// chunks of encrypted backups are not the same between runs
+	if task.Encryption.Enabled() && task.Repository {
+		return nil, fmt.Errorf("encryption is not supported by repository of task %s", task.Id)
+	}
+
+	if task.Encryption.Enabled() {
+		enc, err := encrypt.NewEncryptor(task.Encryption.Recipients, task.Encryption.RecipientsFile)
+		if err != nil {
+			return nil, errors.Join(err, fmt.Errorf("could not init encryption of task %s", task.Id))
+		}
+		main.Encryptor = enc
 	}
 
 	for _, db := range task.Databases {
@@ -5,6 +5,7 @@ import (
 
 	"github.com/vilasle/backilli/internal/database"
 	"github.com/vilasle/backilli/internal/period"
+	"github.com/vilasle/backilli/internal/tool/encrypt"
 	"github.com/vilasle/backilli/pkg/fs/manager"
 )
 
@@ -21,10 +22,22 @@ type BuilderConfig struct {
 	PeriodRule    period.PeriodRule
 	Compress      bool
 	Keep          int
+	// KeepPerVolume - count of kept copies for volume with id, it overrides Keep
+	KeepPerVolume map[string]int
 	IncludeRegexp string
 	ExcludeRegexp string
 	DatabaseManager database.Manager
 	FsManagers    []manager.ManagerAtomic
+	// Encryptor - backups are encrypted before uploading if it is defined
+	Encryptor *encrypt.Encryptor
+	// PathTemplate - layout of backups on volumes, DefaultPathTemplate is used if it is empty
+	PathTemplate string
+	// Repository - backups are stored as snapshots of deduplicating repository instead of files
+	Repository bool
+	// WritePolicy - "all" (default), "quorum N" or "first-available"
+	WritePolicy string
+	// Tiering - old copies are moved to colder volume if it is defined
+	Tiering *Tiering
 }
 
 func build(conf BuilderConfig) (Entity, error) {
@@ -1,41 +1,51 @@
 package entity
 
 import (
-	"bytes"
 	"errors"
-	"io"
+	"fmt"
 	"os"
 	"path/filepath"
-	"runtime"
-	"sort"
-	"strings"
-	"sync"
 	"time"
 
+	"github.com/vilasle/backilli/internal/tool/encrypt"
 	"github.com/vilasle/backilli/pkg/fs"
 	"github.com/vilasle/backilli/pkg/fs/manager"
 	"github.com/vilasle/backilli/pkg/fs/manager/local"
 	"github.com/vilasle/backilli/pkg/fs/unit"
 	"github.com/vilasle/backilli/pkg/logger"
+	"github.com/vilasle/backilli/pkg/progress"
 )
 
 const (
-	packSize = 4
+	// retentionHorizon - how many days are looked through for the next executions of entity
+	retentionHorizon = 10 * 366
 )
 
-var (
-	arErr = make([]error, 0)
-	arbck = make([]string, 0)
-)
+// ErrNoSpace - transitory catalog or volume does not have space for backup
+var ErrNoSpace = errors.New("not enough free space for backup")
 
-type packItem struct {
-	name    string
-	dir     string
-	content []byte
+// estimator - dump which knows size of backup before dumping
+type estimator interface {
+	EstimateSize() (int64, error)
 }
 
-func (p *packItem) getBuffer() *bytes.Buffer {
-	return bytes.NewBuffer(p.content)
+// Upload - result of sending file of backup to volume. Upload without File is volume which was not used,
+// because it could not receive backup before writing
+type Upload struct {
+	Volume   string
+	File     string
+	Path     string
+	Retries  int
+	SHA256   string
+	Verified bool
+	Err      error
+}
+
+// packItem - file of backup which is streamed from disk to every target
+type packItem struct {
+	name string
+	path string
+	sum  unit.Checksum
 }
 
 func prepareTempPlace(tempdir string, name string) (t string, err error) {
@@ -67,6 +77,81 @@ func checkTemp(path string) error {
 	return err
 }
 
+// failedVolumes returns volumes of entity which are unhealthy by check of process, backup is not written to them
+func failedVolumes(e EntityInfo, s EntitySetting) map[string]error {
+	res := make(map[string]error)
+	for _, m := range e.FileManagers() {
+		if err, ok := s.Unhealthy[manager.VolumeId(m)]; ok {
+			res[manager.VolumeId(m)] = err
+		}
+	}
+	return res
+}
+
+// checkFreeSpace checks that transitory catalog and volumes of entity have space for backup of estimated size.
+// Size of source is used as estimation, it is not less than backup usually. Backup is not possible without space
+// in transitory catalog. Volumes without space are added to failed, backup is not written to them.
+// Failed volumes and volumes which do not report free space are not checked
+func checkFreeSpace(e EntityInfo, temp string, est estimator, failed map[string]error) error {
+	size, err := est.EstimateSize()
+	if err != nil {
+		logger.Warn("could not estimate size of backup, free space is not checked", "task", e.Id(), "error", err)
+		return nil
+	}
+	logger.Debug("estimated size of backup", "task", e.Id(), "size", size)
+
+	if err := hasSpace(local.NewClient(unit.ClientConfig{Id: "transitory", Root: temp}), size); err != nil {
+		return err
+	}
+
+	for _, m := range e.FileManagers() {
+		if _, ok := failed[manager.VolumeId(m)]; ok {
+			continue
+		}
+		if err := hasSpace(m, size); err != nil {
+			failed[manager.VolumeId(m)] = err
+		}
+	}
+	return nil
+}
+
+func hasSpace(m manager.ManagerAtomic, size int64) error {
+	free, err := manager.FreeSpace(m)
+	if errors.Is(err, manager.ErrUnknownFreeSpace) {
+		return nil
+	} else if err != nil {
+		logger.Warn("could not get free space of volume", "volume", manager.VolumeId(m), "error", err)
+		return nil
+	}
+
+	if free < size {
+		return fmt.Errorf("%w: volume %s has %d bytes, estimated size of backup is %d bytes",
+			ErrNoSpace, manager.VolumeId(m), free, size)
+	}
+	return nil
+}
+
+// retainUntil returns time till which copy made at t has to be kept on volumes.
+// ClearOldCopies removes copy when keep newer copies are made, so it is start of day of keep-th next execution.
+// Zero time means that copy is not protected
+func retainUntil(e Entity, keep int, t time.Time) time.Time {
+	if keep <= 0 {
+		return time.Time{}
+	}
+
+	day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+	for i := 1; i <= retentionHorizon; i++ {
+		next := day.AddDate(0, 0, i)
+		if !e.CheckPeriodRules(next) {
+			continue
+		}
+		if keep--; keep == 0 {
+			return next
+		}
+	}
+	return time.Time{}
+}
+
 func clearTempFile(wordDir string, paths ...string) error {
 	c := local.NewClient(unit.ClientConfig{Root: wordDir})
 	for i := range paths {
@@ -80,193 +165,152 @@ func clearTempFile(wordDir string, paths ...string) error {
 	return nil
 }
 
-func moveBackupToDestination(e EntityInfo, t time.Time) ([]string, error) {
-	var (
-		paths  = e.BackupFilePath()
-		length = len(paths)
-	)
-	logger.Debug("moving backups to destination")
-	for i := 0; i < length; i = i + packSize {
-		finish := i + packSize
-		if length < finish {
-			finish = length
-		}
-		parts := paths[i:finish]
+// jobName identifies backup of entity in progress events
+func jobName(e EntityInfo) string {
+	return e.Id() + "/" + e.OID()
+}
 
-		pack, err := createPackage(parts)
+// encryptFiles replaces files of backup by encrypted files
+func encryptFiles(enc *encrypt.Encryptor, files []string) ([]string, error) {
+	res := make([]string, 0, len(files))
+	for _, f := range files {
+		logger.Debug("encrypting file", "file", f, "fingerprint", enc.Fingerprint())
+		encrypted, err := enc.EncryptFile(f)
 		if err != nil {
 			return nil, err
 		}
+		res = append(res, encrypted)
+	}
+	return res, nil
+}
 
-		sendPackageToDestination(e, pack, t)
+// sendBackup writes backup of entity to volumes by write policy, backup is stored as files or in repository.
+// Volumes of failed can not receive backup (unhealthy, no space), they are not used.
+// It returns true if backup was not written to some volumes, but policy is satisfied
+func sendBackup(e EntityInfo, p WritePolicy, sch *UploadScheduler, t time.Time, opts map[string]unit.WriteOptions, failed map[string]error) ([]Upload, bool, error) {
+	return p.write(e.FileManagers(), failed, func(volumes []manager.ManagerAtomic) ([]Upload, error) {
+		if e.Repository() {
+			return storeInRepositories(e, volumes, sch, t)
+		}
+		return moveBackupToDestination(e, volumes, sch, t, opts)
+	})
+}
 
-		runtime.GC()
+// moveBackupToDestination sends files of backup to volumes through scheduler.
+// opts are options of every volume which are common for all files, size is set for every file
+func moveBackupToDestination(e EntityInfo, volumes []manager.ManagerAtomic, sch *UploadScheduler, t time.Time, opts map[string]unit.WriteOptions) ([]Upload, error) {
+	if sch == nil {
+		sch = NewUploadScheduler(0, 0)
+	}
+	logger.Debug("moving backups to destination")
 
+	pack, err := createPackage(e.BackupFilePath())
+	if err != nil {
+		return nil, err
 	}
+	uploads := sch.uploadTo(e, volumes, pack, t, opts)
 
-	if len(arErr) > 0 {
-		return nil, errors.Join(arErr...)
-	} else {
-		return arbck, nil
+	errs := make([]error, 0)
+	for _, u := range uploads {
+		if u.Err != nil {
+			errs = append(errs, u.Err)
+		}
+	}
+	return uploads, errors.Join(errs...)
+}
+
+// uploadedPaths returns paths of files which were sent to volumes successfully
+func uploadedPaths(uploads []Upload) []string {
+	res := make([]string, 0, len(uploads))
+	for _, u := range uploads {
+		if u.Err == nil {
+			res = append(res, u.Path)
+		}
 	}
+	return res
 }
 
 func createPackage(paths []string) ([]packItem, error) {
-	pack := make([]packItem, 0, packSize)
+	pack := make([]packItem, 0, len(paths))
 
 	for _, backpath := range paths {
-		if _, err := os.Stat(backpath); os.IsNotExist(err) {
-			return nil, err
-		}
-
-		file, err := putFileIntoMemory(backpath)
+		sum, err := fileChecksum(backpath)
 		if err != nil {
 			return nil, err
 		}
 
-		dir := strings.Split(filepath.Base(backpath), ".")[0]
 		name := filepath.Base(backpath)
 		pack = append(pack, packItem{
-			name:    name,
-			dir:     dir,
-			content: file,
+			name: name,
+			path: backpath,
+			sum:  sum,
 		})
 	}
 	return pack, nil
 }
 
-func sendPackageToDestination(e EntityInfo, pack []packItem, t time.Time) {
-	wg := &sync.WaitGroup{}
-	for _, it := range pack {
-		for _, m := range e.FileManagers() {
-			go sendFile(m, e, t, it, wg)
-		}
+func fileChecksum(path string) (unit.Checksum, error) {
+	fd, err := os.Open(path)
+	if err != nil {
+		return unit.Checksum{}, err
 	}
-	wg.Wait()
+	defer fd.Close()
+
+	return unit.ComputeChecksum(fd)
 }
 
-func sendFile(m manager.ManagerAtomic, e EntityInfo, t time.Time, it packItem, wg *sync.WaitGroup) {
-	wg.Add(1)
-	defer wg.Done()
-	dest := fs.GetFullPath("", e.Id(), t.Format("02-01-2006"), it.dir, it.name)
+func sendFile(m manager.ManagerAtomic, e EntityInfo, t time.Time, it packItem, opt unit.WriteOptions) Upload {
+	dest := e.PathTemplate().Path(e.Id(), e.OID(), it.name, t)
+	upload := Upload{Volume: manager.VolumeId(m), File: it.name, SHA256: it.sum.SHA256}
 
 	logger.Debug("start moving to target manager", "manager", m.Description(), "dest", dest)
 
-	if path, err := m.Write(it.getBuffer(), dest); err != nil {
-		arErr = append(arErr, err)
-	} else {
-		arbck = append(arbck, path)
+	// every target reads file by itself, so slow target does not hold others
+	fd, err := os.Open(it.path)
+	if err != nil {
+		upload.Err = err
+		return upload
 	}
+	defer fd.Close()
+
+	opt.Size = it.sum.Size
+	tracker := progress.Start(jobName(e)+"/"+it.name, progress.StageUpload, upload.Volume, it.sum.Size)
+	upload.Path, upload.Retries, upload.Err = manager.WriteWithRetries(m, tracker.Reader(fd), dest, opt)
+	tracker.Finish()
 	logger.Debug("finish moving to target manager",
 		"manager", m.Description(),
 		"dest", dest,
+		"retries", upload.Retries,
 		"diff", time.Since(t).String())
-}
-
-func putFileIntoMemory(path string) ([]byte, error) {
-	var (
-		err  error
-		fd   *os.File
-		stat os.FileInfo
-	)
-
-	fd, err = os.OpenFile(path, os.O_RDONLY, os.ModePerm)
-	if err != nil {
-		return nil, err
-	}
-	defer fd.Close()
-
-	stat, err = fd.Stat()
-	if err != nil {
-		return nil, err
+	if upload.Err != nil {
+		return upload
 	}
-	file := make([]byte, stat.Size())
 
-	_, err = fd.Read(file)
-	if err != nil {
-		return nil, err
+	switch err := manager.Verify(m, dest, it.sum); {
+	case err == nil:
+		upload.Verified = true
+	case errors.Is(err, manager.ErrUnverifiable):
+		logger.Warn("file on volume was not verified", "manager", m.Description(), "dest", dest)
+	default:
+		upload.Err = errors.Join(err, fmt.Errorf("verification of %s failed", upload.Path))
 	}
-
-	if err == io.EOF {
-		return file, nil
-	}
-
-	return file, err
+	return upload
 }
 
-func ClearOldCopies(e EntityInfo, keep int) ([]string, error) {
+// ClearOldCopies keeps the newest copies of entity on every volume, count of copies is taken from retention of volume.
+// Copies are found and dated by path template of entity. Volumes which did not receive the last backup are not touched
+func ClearOldCopies(e EntityInfo, r Retention) ([]string, error) {
 	arErr := make([]error, 0)
 	arrMd := make([]string, 0)
 
 	for _, m := range e.FileManagers() {
-		ls, err := m.Ls(e.Id())
-		if err != nil {
-			if os.IsNotExist(err) {
-				continue
-			}
-			return nil, err
-		}
-
-		logger.Debug("list of backups", "list", ls)
-
-		sort.Slice(ls, func(i, j int) bool {
-			var xt, yt time.Time
-			var err error
-			x := ls[i]
-			y := ls[j]
-			xt, err = time.Parse("02-01-2006", x.Name)
-			if err != nil {
-				xt = x.Date
-			}
-
-			yt, err = time.Parse("02-01-2006", y.Name)
-			if err != nil {
-				yt = y.Date
-			}
-
-			return xt.Before(yt)
-		})
-
-		logger.Debug("condition of removing old copies", "keep", keep, "qty", len(ls))
-
-		if len(ls) <= keep {
-			logger.Debug("don't need to remove old copies")
+		if failedOn(e, m) {
 			continue
 		}
-
-		logger.Debug("removing old copies", "qty", len(ls)-keep)
-
-		remove := ls[:len(ls)-keep]
-
-		for _, r := range remove {
-			path := fs.GetFullPath("/", e.Id(), r.Name)
-			localLs, err := m.Ls(path)
-			if err != nil {
-				arErr = append(arErr, err)
-			}
-
-			for _, f := range localLs {
-				oid := e.OID()
-				if f.Name == oid {
-					rmf := fs.GetFullPath("/", path, f.Name)
-					if err := m.Remove(rmf); err != nil {
-						arErr = append(arErr, err)
-					} else {
-						arrMd = append(arrMd, rmf)
-					}
-				}
-			}
-
-			localLs, err = m.Ls(path)
-			if err != nil {
-				arErr = append(arErr, err)
-			}
-
-			if len(localLs) == 0 {
-				if err := m.Remove(path); err != nil {
-					arrMd = append(arrMd, path)
-				}
-			}
+		rmd, err := e.PathTemplate().removeOldCopies(m, e.Id(), e.OID(), r.KeepOn(manager.VolumeId(m)), time.Local)
+		arrMd = append(arrMd, rmd...)
+		if err != nil {
+			arErr = append(arErr, err)
 		}
 	}
 
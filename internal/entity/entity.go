@@ -10,16 +10,25 @@ import (
 const (
 	execStatusSuccess = "success"
 	execStatusErr     = "error"
+	execStatusSkipped = "skipped"
+	// execStatusDegraded - backup satisfies write policy, but it was not written to some volumes
+	execStatusDegraded = "degraded"
 )
 
 type Entity interface {
 	Backup(EntitySetting, time.Time)
 	CheckPeriodRules(time.Time) bool
+	// Skip marks entity as not executed by reason
+	Skip(error)
 	Err() error
 }
 
 type EntitySetting struct {
 	Tempdir string
+	// Scheduler - limits of concurrent uploads which are common for entities of process
+	Scheduler *UploadScheduler
+	// Unhealthy - errors of volumes which did not pass check of process, backup is not written to them
+	Unhealthy map[string]error
 }
 
 type EntityInfo interface {
@@ -33,6 +42,15 @@ type EntityInfo interface {
 	StartTime() time.Time
 	EndTime() time.Time
 	BackupPaths() []string
+	Uploads() []Upload
+	// KeyFingerprint identifies keys which backup was encrypted for, it is empty if backup is not encrypted
+	KeyFingerprint() string
+	// PathTemplate - layout of backups of entity on volumes
+	PathTemplate() PathTemplate
+	// Repository - backups are stored in deduplicating repository
+	Repository() bool
+	// WritePolicy - which volumes have to receive backup
+	WritePolicy() WritePolicy
 	Err() error
 }
 
@@ -0,0 +1,624 @@
+package entity
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/vilasle/backilli/internal/period"
+	"github.com/vilasle/backilli/pkg/fs/manager"
+	"github.com/vilasle/backilli/pkg/fs/manager/local"
+	"github.com/vilasle/backilli/pkg/fs/manager/memory"
+	"github.com/vilasle/backilli/pkg/fs/unit"
+	"github.com/vilasle/backilli/pkg/logger"
+)
+
+func TestRetainUntil(t *testing.T) {
+	daily := &fileEntity{
+		pr: period.PeriodRule{Day: period.NewWeekdaysRule([]int{
+			period.Mon, period.Tue, period.Wed, period.Thu, period.Fri, period.Sat, period.Sun,
+		})},
+	}
+
+	// copy of friday is removed by the third backup on monday
+	friday := time.Date(2023, 1, 6, 22, 30, 0, 0, time.UTC)
+	if until := retainUntil(daily, 3, friday); !until.Equal(time.Date(2023, 1, 9, 0, 0, 0, 0, time.UTC)) {
+		t.Fatalf("unexpected time of retention %v", until)
+	}
+
+	if until := retainUntil(daily, 0, friday); !until.IsZero() {
+		t.Fatalf("copy should not be retained without keeping, there is %v", until)
+	}
+
+	never := &fileEntity{}
+	if until := retainUntil(never, 3, friday); !until.IsZero() {
+		t.Fatalf("copy of entity which is not executed should not be retained, there is %v", until)
+	}
+}
+
+func TestPathTemplate(t *testing.T) {
+	run := time.Date(2023, 1, 6, 22, 30, 5, 0, time.UTC)
+
+	def, err := NewPathTemplate("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p := def.Path("accounting", "db", "db.zip", run); p != "accounting/06-01-2023/db/db.zip" {
+		t.Fatalf("unexpected path by default template %s", p)
+	}
+
+	custom, err := NewPathTemplate("/{task}/{date:2006-01-02}/{time}_{oid}/{file}")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p := custom.Path("accounting", "db", "db.zip", run); p != "accounting/2023-01-06/22-30-05_db/db.zip" {
+		t.Fatalf("unexpected path by custom template %s", p)
+	}
+
+	for _, template := range []string{
+		"{task}/{date:2006-01-02}/{file}",
+		"{task}/{file}/{oid}",
+		"{task}/{date}/{oid}/{file}",
+		"{task}/{week}/{oid}/{file}",
+		"{task}//{oid}/{file}",
+		// parts of archive of one run would be dated by modification and counted as different copies
+		"{task}/{oid}/{file}",
+		"{host}/{task}_{oid}/{file}",
+	} {
+		if _, err := NewPathTemplate(template); err == nil {
+			t.Fatalf("expected error of template %s", template)
+		}
+	}
+}
+
+func TestClearOldCopiesByTemplate(t *testing.T) {
+	logger.Init("local", io.Discard)
+
+	layout, err := NewPathTemplate("{task}/{date:2006-01-02}/{time}/{oid}/{file}")
+	if err != nil {
+		t.Fatal(err)
+	}
+	volume := memory.NewClient(unit.ClientConfig{Id: "memory"})
+	e := &fileEntity{
+		id:         "files",
+		srcFile:    "/data/src",
+		layout:     layout,
+		fsManagers: []manager.ManagerAtomic{volume},
+	}
+
+	// two runs per day, the last one of 2023 is older than runs of 2024
+	runs := []time.Time{
+		time.Date(2023, 12, 31, 23, 0, 0, 0, time.Local),
+		time.Date(2024, 1, 2, 9, 0, 0, 0, time.Local),
+		time.Date(2024, 1, 2, 21, 0, 0, 0, time.Local),
+	}
+	for _, r := range runs {
+		for _, name := range []string{"src.zip.001", "src.zip.002"} {
+			if _, err := volume.Write(bytes.NewReader([]byte(name)), layout.Path(e.id, e.OID(), name, r), unit.WriteOptions{}); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	// copy of other entity of task is not touched
+	other := layout.Path(e.id, "other", "other.zip", runs[0])
+	if _, err := volume.Write(bytes.NewReader([]byte("other")), other, unit.WriteOptions{}); err != nil {
+		t.Fatal(err)
+	}
+
+	removed, err := ClearOldCopies(e, Retention{Keep: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(removed)
+	expected := []string{"files/2023-12-31/23-00-00/src/src.zip.001", "files/2023-12-31/23-00-00/src/src.zip.002"}
+	if strings.Join(removed, ",") != strings.Join(expected, ",") {
+		t.Fatalf("expected removing of %v, there are %v", expected, removed)
+	}
+
+	if _, err := volume.Read(other); err != nil {
+		t.Fatalf("copy of other entity was removed: %v", err)
+	}
+	ls, err := volume.Ls("files/2023-12-31/23-00-00")
+	if err != nil || len(ls) != 1 || ls[0].Name != "other" {
+		t.Fatalf("expected directory of other entity only, there are %v, %v", ls, err)
+	}
+	for _, r := range runs[1:] {
+		if _, err := volume.Read(layout.Path(e.id, e.OID(), "src.zip.001", r)); err != nil {
+			t.Fatalf("the newest copy was removed: %v", err)
+		}
+	}
+}
+
+// concurrency - counter of concurrent writes
+type concurrency struct {
+	current, max atomic.Int32
+}
+
+func (c *concurrency) enter() {
+	n := c.current.Add(1)
+	for m := c.max.Load(); n > m && !c.max.CompareAndSwap(m, n); m = c.max.Load() {
+	}
+}
+
+// countingVolume - memory volume which counts concurrent writes to it and to all volumes of test
+type countingVolume struct {
+	*memory.MemoryClient
+	volume, all *concurrency
+	fail        bool
+}
+
+func (v *countingVolume) Write(rd io.Reader, dst string, opt unit.WriteOptions) (string, error) {
+	v.volume.enter()
+	v.all.enter()
+	defer v.volume.current.Add(-1)
+	defer v.all.current.Add(-1)
+
+	time.Sleep(5 * time.Millisecond)
+	if v.fail {
+		return "", errors.New("volume is not available")
+	}
+	return v.MemoryClient.Write(rd, dst, opt)
+}
+
+func TestUploadScheduler(t *testing.T) {
+	logger.Init("local", io.Discard)
+
+	layout, err := NewPathTemplate("")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	all := &concurrency{}
+	volumes := make([]*countingVolume, 3)
+	managers := make([]manager.ManagerAtomic, 0, len(volumes))
+	for i := range volumes {
+		volumes[i] = &countingVolume{
+			MemoryClient: memory.NewClient(unit.ClientConfig{Id: fmt.Sprintf("volume-%d", i)}),
+			volume:       &concurrency{},
+			all:          all,
+			fail:         i == 2,
+		}
+		managers = append(managers, volumes[i])
+	}
+
+	dir := t.TempDir()
+	paths := make([]string, 0)
+	for i := 1; i <= 10; i++ {
+		p := filepath.Join(dir, fmt.Sprintf("src.zip.%03d", i))
+		if err := os.WriteFile(p, []byte(p), os.ModePerm); err != nil {
+			t.Fatal(err)
+		}
+		paths = append(paths, p)
+	}
+	pack, err := createPackage(paths)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	e := &fileEntity{id: "files", srcFile: "/data/src", layout: layout, fsManagers: managers}
+	sch := NewUploadScheduler(4, 2)
+
+	// entities of process share limits of scheduler
+	var (
+		wg      sync.WaitGroup
+		results = make([][]Upload, 2)
+	)
+	for i := range results {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			results[i] = sch.uploadTo(e, e.FileManagers(), pack, time.Now(), nil)
+		}(i)
+	}
+	wg.Wait()
+
+	if all.max.Load() > 4 {
+		t.Fatalf("global limit is exceeded, there were %d concurrent uploads", all.max.Load())
+	}
+	for _, v := range volumes {
+		if v.volume.max.Load() > 2 {
+			t.Fatalf("limit of volume is exceeded, there were %d concurrent uploads", v.volume.max.Load())
+		}
+	}
+
+	for _, uploads := range results {
+		if len(uploads) != len(pack)*len(volumes) {
+			t.Fatalf("expected result of every part on every volume, there are %d", len(uploads))
+		}
+		for _, u := range uploads {
+			if failed := u.Volume == "volume-2"; failed != (u.Err != nil) || u.File == "" {
+				t.Fatalf("unexpected result of %s on %s: %v", u.File, u.Volume, u.Err)
+			}
+		}
+	}
+}
+
+// newVolumes returns volumes of every kind with root, so paths relative to root differ from paths of files on volume
+func newVolumes(t *testing.T, ids ...string) map[string][]manager.ManagerAtomic {
+	res := make(map[string][]manager.ManagerAtomic)
+	for _, id := range ids {
+		res["memory"] = append(res["memory"], memory.NewClient(unit.ClientConfig{Id: id, Root: "backups"}))
+		res["local"] = append(res["local"], local.NewClient(unit.ClientConfig{Id: id, Root: filepath.Join(t.TempDir(), "backups")}))
+	}
+	return res
+}
+
+// content returns content of copy which is larger than buffers of volumes
+func content(p string) []byte {
+	return bytes.Repeat([]byte(p), 256*1024/len(p)+1)
+}
+
+func TestReplicate(t *testing.T) {
+	logger.Init("local", io.Discard)
+
+	for name, volumes := range newVolumes(t, "from", "to") {
+		t.Run(name, func(t *testing.T) {
+			testReplicate(t, volumes[0], volumes[1])
+		})
+	}
+}
+
+func testReplicate(t *testing.T, from, to manager.ManagerAtomic) {
+	layout, err := NewPathTemplate("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	e := &fileEntity{
+		id:         "files",
+		srcFile:    "/data/src",
+		layout:     layout,
+		fsManagers: []manager.ManagerAtomic{from},
+	}
+
+	runs := []time.Time{
+		time.Date(2024, 1, 1, 21, 0, 0, 0, time.Local),
+		time.Date(2024, 1, 2, 21, 0, 0, 0, time.Local),
+	}
+	paths := make([]string, 0, len(runs))
+	for _, r := range runs {
+		p := e.layout.Path(e.id, e.OID(), "src.zip", r)
+		if _, err := from.Write(bytes.NewReader(content(p)), p, unit.WriteOptions{}); err != nil {
+			t.Fatal(err)
+		}
+		paths = append(paths, p)
+	}
+
+	replicas, err := Replicate(e, from, to)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(replicas) != len(paths) {
+		t.Fatalf("expected copying of %d files, there are %v", len(paths), replicas)
+	}
+	for _, r := range replicas {
+		if r.Skipped || r.Err != nil || r.Size != int64(len(content(r.Path))) {
+			t.Fatalf("expected copying of %s, there is %+v", r.Path, r)
+		}
+	}
+
+	// changed copy on target is replaced, the same one is skipped
+	if _, err := to.Write(bytes.NewReader([]byte("damaged")), paths[0], unit.WriteOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	replicas, err = Replicate(e, from, to)
+	if err != nil {
+		t.Fatal(err)
+	}
+	skipped := make(map[string]bool)
+	for _, r := range replicas {
+		skipped[r.Path] = r.Skipped
+	}
+	if skipped[paths[0]] || !skipped[paths[1]] {
+		t.Fatalf("expected copying of changed file only, there are %v", replicas)
+	}
+	for _, p := range paths {
+		res, err := to.Read(p)
+		if err != nil || !bytes.Equal(res, content(p)) {
+			t.Fatalf("unexpected content of %s on target: %d bytes, %v", p, len(res), err)
+		}
+	}
+}
+
+// interruptedVolume - memory volume which loses connection in the middle of the first writing
+type interruptedVolume struct {
+	*memory.MemoryClient
+	interrupted bool
+}
+
+func (v *interruptedVolume) Write(rd io.Reader, dst string, opt unit.WriteOptions) (string, error) {
+	if !v.interrupted {
+		v.interrupted = true
+		io.ReadFull(rd, make([]byte, 1024))
+		return "", errors.New("connection reset by peer")
+	}
+	return v.MemoryClient.Write(rd, dst, opt)
+}
+
+func TestReplicateRetry(t *testing.T) {
+	logger.Init("local", io.Discard)
+
+	from := memory.NewClient(unit.ClientConfig{Id: "from", Root: "backups"})
+	to := &interruptedVolume{MemoryClient: memory.NewClient(unit.ClientConfig{Id: "to", Root: "backups"})}
+
+	p := "files/src/src.zip"
+	if _, err := from.Write(bytes.NewReader(content(p)), p, unit.WriteOptions{}); err != nil {
+		t.Fatal(err)
+	}
+
+	// copy is written again from the beginning of file of source volume
+	r := replicateFile(from, manager.NewRetryManager(to, unit.RetryPolicy{Attempts: 2, Delay: time.Millisecond}), p)
+	if r.Err != nil {
+		t.Fatal(r.Err)
+	}
+	if res, err := to.Read(p); err != nil || !bytes.Equal(res, content(p)) {
+		t.Fatalf("unexpected content of %s on target: %d bytes, %v", p, len(res), err)
+	}
+}
+
+func TestRetentionPerVolume(t *testing.T) {
+	logger.Init("local", io.Discard)
+
+	layout, err := NewPathTemplate("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fast := memory.NewClient(unit.ClientConfig{Id: "fast"})
+	cold := memory.NewClient(unit.ClientConfig{Id: "cold"})
+	e := &fileEntity{
+		id:      "files",
+		srcFile: "/data/src",
+		layout:  layout,
+		pr: period.PeriodRule{Day: period.NewWeekdaysRule([]int{
+			period.Mon, period.Tue, period.Wed, period.Thu, period.Fri, period.Sat, period.Sun,
+		})},
+		fsManagers: []manager.ManagerAtomic{fast, cold},
+	}
+	r := Retention{Keep: 1, PerVolume: map[string]int{"cold": 3}}
+
+	run := time.Date(2024, 1, 1, 21, 0, 0, 0, time.Local)
+	for i := 0; i < 4; i++ {
+		for _, m := range e.fsManagers {
+			p := layout.Path(e.id, e.OID(), "src.zip", run.AddDate(0, 0, i))
+			if _, err := m.Write(bytes.NewReader([]byte(p)), p, unit.WriteOptions{}); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	if _, err := ClearOldCopies(e, r); err != nil {
+		t.Fatal(err)
+	}
+	for m, keep := range map[manager.ManagerAtomic]int{fast: 1, cold: 3} {
+		ls, err := m.Ls("files")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(ls) != keep {
+			t.Fatalf("expected %d copies on volume %s, there are %v", keep, manager.VolumeId(m), ls)
+		}
+	}
+
+	opts := writeOptions(e, e.fsManagers, r, run)
+	if !opts["fast"].RetainUntil.Equal(time.Date(2024, 1, 2, 0, 0, 0, 0, time.Local)) ||
+		!opts["cold"].RetainUntil.Equal(time.Date(2024, 1, 4, 0, 0, 0, 0, time.Local)) {
+		t.Fatalf("copies should be locked by retention of volume, there are %v", opts)
+	}
+}
+
+func TestWritePolicy(t *testing.T) {
+	logger.Init("local", io.Discard)
+
+	for policy, valid := range map[string]bool{
+		"":                  true,
+		"all":               true,
+		"quorum 3":          true,
+		"first-available":   true,
+		"quorum 4":          false,
+		"quorum x":          false,
+		"quorum":            false,
+		"first-available 1": false,
+		"any":               false,
+	} {
+		if _, err := NewWritePolicy(policy, 3); (err == nil) != valid {
+			t.Fatalf("unexpected result of parsing of policy '%s': %v", policy, err)
+		}
+	}
+
+	layout, err := NewPathTemplate("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	managers := make([]manager.ManagerAtomic, 0, 3)
+	for i := 0; i < 3; i++ {
+		managers = append(managers, &countingVolume{
+			MemoryClient: memory.NewClient(unit.ClientConfig{Id: fmt.Sprintf("volume-%d", i)}),
+			volume:       &concurrency{},
+			all:          &concurrency{},
+			fail:         i == 0,
+		})
+	}
+	p := filepath.Join(t.TempDir(), "src.zip")
+	if err := os.WriteFile(p, []byte(p), os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	e := &fileEntity{id: "files", srcFile: "/data/src", layout: layout, fsManagers: managers, backupFiles: []string{p}}
+
+	for policy, expected := range map[string]struct {
+		degraded, failed bool
+		uploads          int
+	}{
+		"all":             {failed: true, uploads: 3},
+		"quorum 2":        {degraded: true, uploads: 3},
+		"quorum 3":        {failed: true, uploads: 3},
+		"first-available": {degraded: true, uploads: 2},
+	} {
+		wp, err := NewWritePolicy(policy, len(managers))
+		if err != nil {
+			t.Fatal(err)
+		}
+		uploads, degraded, err := sendBackup(e, wp, nil, time.Now(), nil, nil)
+		if (err != nil) != expected.failed || degraded != expected.degraded || len(uploads) != expected.uploads {
+			t.Fatalf("unexpected result of policy '%s': degraded %v, uploads %v, error %v", policy, degraded, uploads, err)
+		}
+	}
+
+	// the first available volume which accepts backup stops failover
+	wp, err := NewWritePolicy(WriteFirstAvailable, len(managers))
+	if err != nil {
+		t.Fatal(err)
+	}
+	e.uploads, _, _ = sendBackup(e, wp, nil, time.Now(), nil, nil)
+	results := VolumeResults(e)
+	if !results[0].Attempted || results[0].Written || !results[1].Written || results[2].Attempted {
+		t.Fatalf("unexpected results of volumes %+v", results)
+	}
+
+	// volumes are tried in order of volumes of entity, backup goes to the first healthy one
+	for _, failed := range [][]bool{
+		{true, true, false, false},
+		{false, true, true, false},
+		{true, true, true, false},
+	} {
+		volumes := make([]manager.ManagerAtomic, 0, len(failed))
+		for i, fail := range failed {
+			volumes = append(volumes, &countingVolume{
+				MemoryClient: memory.NewClient(unit.ClientConfig{Id: fmt.Sprintf("volume-%d", i)}),
+				volume:       &concurrency{},
+				all:          &concurrency{},
+				fail:         fail,
+			})
+		}
+		e := &fileEntity{id: "files", srcFile: "/data/src", layout: layout, fsManagers: volumes, backupFiles: []string{p}}
+		wp, err := NewWritePolicy(WriteFirstAvailable, len(volumes))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if e.uploads, _, err = sendBackup(e, wp, nil, time.Now(), nil, nil); err != nil {
+			t.Fatal(err)
+		}
+
+		primary := 0
+		for failed[primary] {
+			primary++
+		}
+		for i, r := range VolumeResults(e) {
+			if r.Attempted != (i <= primary) || r.Written != (i == primary) {
+				t.Fatalf("expected failover to volume-%d for failed volumes %v, there are %+v", primary, failed, VolumeResults(e))
+			}
+		}
+	}
+}
+
+func TestMoveMatured(t *testing.T) {
+	logger.Init("local", io.Discard)
+
+	layout, err := NewPathTemplate("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	hot := memory.NewClient(unit.ClientConfig{Id: "hot"})
+	cold := memory.NewClient(unit.ClientConfig{Id: "cold"})
+	e := &fileEntity{id: "files", srcFile: "/data/src", layout: layout, fsManagers: []manager.ManagerAtomic{hot}}
+
+	now := time.Date(2024, 1, 10, 21, 0, 0, 0, time.Local)
+	paths := make([]string, 0)
+	for _, day := range []int{1, 2, 3, 8, 9, 10} {
+		for _, name := range []string{"src.zip.001", "src.zip.002"} {
+			p := layout.Path(e.id, e.OID(), name, time.Date(2024, 1, day, 21, 0, 0, 0, time.Local))
+			if _, err := hot.Write(bytes.NewReader([]byte(p)), p, unit.WriteOptions{}); err != nil {
+				t.Fatal(err)
+			}
+			paths = append(paths, p)
+		}
+	}
+
+	// colder volume which is not available keeps copies on volume of entity
+	broken := &countingVolume{MemoryClient: cold, volume: &concurrency{}, all: &concurrency{}, fail: true}
+	if _, err := moveMatured(e, &Tiering{After: 7 * 24 * time.Hour, MoveTo: broken}, Retention{}, now); err == nil {
+		t.Fatal("expected error of colder volume")
+	}
+	for _, p := range paths {
+		if _, err := hot.Read(p); err != nil {
+			t.Fatalf("copy is removed without copying to colder volume: %v", err)
+		}
+	}
+
+	replicas, err := moveMatured(e, &Tiering{After: 7 * 24 * time.Hour, MoveTo: cold}, Retention{PerVolume: map[string]int{"cold": 2}}, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(replicas) != 6 {
+		t.Fatalf("expected moving of copies of 3 days, there are %v", replicas)
+	}
+	for i, p := range paths {
+		_, onHot := hot.Read(p)
+		if matured := i < 6; matured != (onHot != nil) {
+			t.Fatalf("unexpected place of %s, matured %v, error on hot volume %v", p, matured, onHot)
+		}
+	}
+	if ls, err := hot.Ls("files"); err != nil || len(ls) != 3 {
+		t.Fatalf("expected directories of young copies only on hot volume, there are %v, %v", ls, err)
+	}
+
+	// colder volume keeps copies by own retention
+	ls, err := cold.Ls("files")
+	if err != nil || len(ls) != 2 {
+		t.Fatalf("expected 2 copies on colder volume, there are %v, %v", ls, err)
+	}
+	for _, p := range paths[2:6] {
+		if content, err := cold.Read(p); err != nil || string(content) != p {
+			t.Fatalf("unexpected content of %s on colder volume: %q, %v", p, content, err)
+		}
+	}
+}
+
+func TestMoveMaturedLocal(t *testing.T) {
+	logger.Init("local", io.Discard)
+
+	layout, err := NewPathTemplate("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	volumes := newVolumes(t, "hot", "cold")["local"]
+	hot, cold := volumes[0], volumes[1]
+	e := &fileEntity{id: "files", srcFile: "/data/src", layout: layout, fsManagers: []manager.ManagerAtomic{hot}}
+
+	now := time.Date(2024, 1, 10, 21, 0, 0, 0, time.Local)
+	matured := layout.Path(e.id, e.OID(), "src.zip", time.Date(2024, 1, 1, 21, 0, 0, 0, time.Local))
+	young := layout.Path(e.id, e.OID(), "src.zip", time.Date(2024, 1, 9, 21, 0, 0, 0, time.Local))
+	for _, p := range []string{matured, young} {
+		if _, err := hot.Write(bytes.NewReader(content(p)), p, unit.WriteOptions{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	replicas, err := moveMatured(e, &Tiering{After: 7 * 24 * time.Hour, MoveTo: cold}, Retention{}, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(replicas) != 1 || replicas[0].Path != matured {
+		t.Fatalf("expected moving of %s, there are %v", matured, replicas)
+	}
+
+	if res, err := cold.Read(matured); err != nil || !bytes.Equal(res, content(matured)) {
+		t.Fatalf("unexpected content of %s on colder volume: %d bytes, %v", matured, len(res), err)
+	}
+	if _, err := hot.Read(matured); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("expected removing of %s from volume of entity, there is %v", matured, err)
+	}
+	if _, err := hot.Read(young); err != nil {
+		t.Fatalf("young copy is removed: %v", err)
+	}
+	if _, err := cold.Read(young); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("young copy is moved to colder volume: %v", err)
+	}
+}
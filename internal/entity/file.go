@@ -12,6 +12,7 @@ import (
 
 	"github.com/vilasle/backilli/internal/action/dump/file"
 	"github.com/vilasle/backilli/internal/period"
+	"github.com/vilasle/backilli/internal/tool/encrypt"
 	"github.com/vilasle/backilli/pkg/fs"
 	"github.com/vilasle/backilli/pkg/fs/manager"
 	"github.com/vilasle/backilli/pkg/logger"
@@ -30,19 +31,29 @@ type fileEntity struct {
 	backupFiles   []string
 	st            time.Time
 	et            time.Time
-	keep          int
+	retention     Retention
 	status        string
 	backupPaths   []string
+	uploads       []Upload
+	encryptor     *encrypt.Encryptor
+	layout        PathTemplate
+	repository    bool
+	writePolicy   WritePolicy
+	degraded      bool
+	tiering       *Tiering
 	err           error
 }
 
 func newFileEntity(conf BuilderConfig) (*fileEntity, error) {
 	e := &fileEntity{
-		id:       conf.Id,
-		srcFile:  conf.FilePath,
-		compress: conf.Compress,
-		pr:       conf.PeriodRule,
-		keep:     conf.Keep,
+		id:         conf.Id,
+		srcFile:    conf.FilePath,
+		compress:   conf.Compress,
+		pr:         conf.PeriodRule,
+		retention:  Retention{Keep: conf.Keep, PerVolume: conf.KeepPerVolume},
+		encryptor:  conf.Encryptor,
+		repository: conf.Repository,
+		tiering:    conf.Tiering,
 	}
 
 	if len(conf.IncludeRegexp) > 0 {
@@ -62,6 +73,18 @@ func newFileEntity(conf BuilderConfig) (*fileEntity, error) {
 	}
 	e.fsManagers = conf.FsManagers
 
+	layout, err := NewPathTemplate(conf.PathTemplate)
+	if err != nil {
+		return nil, err
+	}
+	e.layout = layout
+
+	policy, err := NewWritePolicy(conf.WritePolicy, len(conf.FsManagers))
+	if err != nil {
+		return nil, err
+	}
+	e.writePolicy = policy
+
 	return e, nil
 }
 
@@ -76,6 +99,8 @@ func (e *fileEntity) Backup(s EntitySetting, t time.Time) {
 		e.status = execStatusSuccess
 		if e.err != nil {
 			e.status = execStatusErr
+		} else if e.degraded {
+			e.status = execStatusDegraded
 		}
 	}()
 
@@ -93,6 +118,16 @@ func (e *fileEntity) Backup(s EntitySetting, t time.Time) {
 	logger.Debug("temp place", "temp", temp)
 
 	dump := file.NewDump(e.srcFile, temp, e.includeRegexp, e.excludeRegexp, e.compress)
+	dump.Job = jobName(e)
+	failed := failedVolumes(e, s)
+	if err := checkFreeSpace(e, temp, dump, failed); err != nil {
+		e.err = err
+		return
+	}
+	if err := e.writePolicy.available(e.fsManagers, failed); err != nil {
+		e.err = err
+		return
+	}
 	logger.Debug("starting dumping", "dump", dump)
 	if err := dump.Dump(); err != nil {
 		e.err = err
@@ -132,13 +167,49 @@ func (e *fileEntity) Backup(s EntitySetting, t time.Time) {
 
 	defer clearTempFile(temp, temp, dump.PathDestination)
 
-	if e.backupPaths, err = moveBackupToDestination(e, t); err != nil {
+	if e.encryptor != nil {
+		if e.backupFiles, err = encryptFiles(e.encryptor, files); err != nil {
+			e.err = err
+			return
+		}
+	}
+
+	e.uploads, e.degraded, err = sendBackup(e, e.writePolicy, s.Scheduler, t, writeOptions(e, e.fsManagers, e.retention, t), failed)
+	e.backupPaths = uploadedPaths(e.uploads)
+	if err != nil {
 		e.err = err
 	}
 
+	e.moveMatured(t)
 	e.clearOldCopies()
 }
 
+func (e *fileEntity) Skip(reason error) {
+	e.st = time.Now()
+	e.et = e.st
+	e.status = execStatusSkipped
+	e.err = reason
+}
+
+func (e fileEntity) KeyFingerprint() string {
+	if e.encryptor == nil {
+		return ""
+	}
+	return e.encryptor.Fingerprint()
+}
+
+func (e fileEntity) PathTemplate() PathTemplate {
+	return e.layout
+}
+
+func (e fileEntity) Repository() bool {
+	return e.repository
+}
+
+func (e fileEntity) WritePolicy() WritePolicy {
+	return e.writePolicy
+}
+
 func (e fileEntity) Err() error {
 	return e.err
 }
@@ -192,8 +263,25 @@ func (e fileEntity) BackupPaths() []string {
 	return e.backupPaths
 }
 
+func (e fileEntity) Uploads() []Upload {
+	return e.uploads
+}
+
+func (e *fileEntity) moveMatured(t time.Time) {
+	if e.tiering == nil {
+		return
+	}
+	if _, err := moveMatured(e, e.tiering, e.retention, t); err != nil {
+		e.err = errors.Join(e.err, err)
+	}
+}
+
 func (e *fileEntity) clearOldCopies() {
-	rmd, err := ClearOldCopies(e, e.keep)
+	remove := ClearOldCopies
+	if e.repository {
+		remove = pruneRepositories
+	}
+	rmd, err := remove(e, e.retention)
 	if err != nil {
 		e.err = err
 	} else {
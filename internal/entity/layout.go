@@ -0,0 +1,324 @@
+package entity
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/vilasle/backilli/pkg/fs/manager"
+	"github.com/vilasle/backilli/pkg/logger"
+)
+
+// DefaultPathTemplate - layout of backups on volumes which is used if task does not define own
+const DefaultPathTemplate = "{task}/{date:02-01-2006}/{oid}/{file}"
+
+// timeLayout - format of placeholder {time}
+const timeLayout = "15-04-05"
+
+const (
+	placeholderTask = "task"
+	placeholderOID  = "oid"
+	placeholderFile = "file"
+	placeholderDate = "date"
+	placeholderTime = "time"
+	placeholderHost = "host"
+)
+
+var placeholderRe = regexp.MustCompile(`\{([a-z]+)(?::([^}]*))?\}`)
+
+// PathTemplate - layout of backups on volume. Segments of path are separated by "/" and contain placeholders:
+//
+//	{task} - id of task
+//	{oid} - name of database or file which is backed up
+//	{file} - name of file of backup, it must be in the last segment
+//	{date:<layout>} - date of run in layout of Go, for example {date:2006-01-02}
+//	{time} - time of run as 15-04-05
+//	{host} - name of host which runs backup
+//
+// Dates of copies are parsed from paths by the same template when old copies are removed
+type PathTemplate struct {
+	raw      string
+	host     string
+	segments []string
+}
+
+// NewPathTemplate checks template, empty template is replaced by DefaultPathTemplate.
+// Template has to contain {oid} so copies of different entities of task are not mixed and {date} or {time}
+// so files of one run (parts of archive) are one copy for retention and tiering
+func NewPathTemplate(template string) (PathTemplate, error) {
+	if template == "" {
+		template = DefaultPathTemplate
+	}
+	p := PathTemplate{raw: template}
+	p.segments = strings.Split(strings.Trim(strings.ReplaceAll(template, "\\", "/"), "/"), "/")
+
+	var hasOID, hasFile, hasRun bool
+	for i, s := range p.segments {
+		if s == "" {
+			return p, fmt.Errorf("path template '%s' contains empty segment", template)
+		}
+		for _, m := range placeholderRe.FindAllStringSubmatch(s, -1) {
+			switch name, layout := m[1], m[2]; {
+			case name == placeholderDate && layout == "":
+				return p, fmt.Errorf("placeholder {date} of path template '%s' does not define layout", template)
+			case name == placeholderFile && i != len(p.segments)-1:
+				return p, fmt.Errorf("placeholder {file} of path template '%s' is not in the last segment", template)
+			case name == placeholderFile:
+				hasFile = true
+			case name == placeholderOID:
+				hasOID = true
+			case name == placeholderDate, name == placeholderTime:
+				hasRun = true
+			case name == placeholderTask, name == placeholderHost:
+			default:
+				return p, fmt.Errorf("unknown placeholder %s in path template '%s'", m[0], template)
+			}
+		}
+	}
+	if !hasFile || !hasOID {
+		return p, fmt.Errorf("path template '%s' has to contain {oid} and {file}", template)
+	}
+	if !hasRun {
+		return p, fmt.Errorf("path template '%s' has to contain {date} or {time}", template)
+	}
+
+	if host, err := os.Hostname(); err == nil {
+		p.host = host
+	}
+	return p, nil
+}
+
+func (p PathTemplate) String() string {
+	return p.raw
+}
+
+// Path returns path of file of backup on volume
+func (p PathTemplate) Path(task, oid, file string, t time.Time) string {
+	segments := make([]string, len(p.segments))
+	for i, s := range p.segments {
+		segments[i] = p.render(s, task, oid, file, t)
+	}
+	return strings.Join(segments, "/")
+}
+
+func (p PathTemplate) render(segment, task, oid, file string, t time.Time) string {
+	return placeholderRe.ReplaceAllStringFunc(segment, func(ph string) string {
+		m := placeholderRe.FindStringSubmatch(ph)
+		switch m[1] {
+		case placeholderTask:
+			return task
+		case placeholderOID:
+			return oid
+		case placeholderFile:
+			return file
+		case placeholderDate:
+			return t.Format(m[2])
+		case placeholderTime:
+			return t.Format(timeLayout)
+		case placeholderHost:
+			return p.host
+		}
+		return ph
+	})
+}
+
+// storedFile - file of backup which was found on volume by template
+type storedFile struct {
+	path string
+	date time.Time
+}
+
+// find looks for files of entity on volume. Date of file is parsed from path, so files of one run have the same date
+func (p PathTemplate) find(m manager.ManagerAtomic, task, oid string, loc *time.Location) ([]storedFile, error) {
+	res := make([]storedFile, 0)
+	err := p.walk(m, "", 0, task, oid, nil, nil, loc, &res)
+	return res, err
+}
+
+func (p PathTemplate) walk(m manager.ManagerAtomic, dir string, depth int, task, oid string,
+	layouts, values []string, loc *time.Location, res *[]storedFile) error {
+	segment := p.segments[depth]
+	last := depth == len(p.segments)-1
+
+	// segment which does not depend on run is not listed
+	if !last && !dependsOnRun(segment) {
+		return p.walk(m, path.Join(dir, p.render(segment, task, oid, "", time.Time{})), depth+1, task, oid, layouts, values, loc, res)
+	}
+
+	ls, err := m.Ls(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+
+	re, segLayouts := p.pattern(segment, task, oid)
+	for _, f := range ls {
+		match := re.FindStringSubmatch(f.Name)
+		if match == nil {
+			continue
+		}
+		l := append(append([]string(nil), layouts...), segLayouts...)
+		v := append(append([]string(nil), values...), match[1:]...)
+		fp := path.Join(dir, f.Name)
+
+		if !last {
+			if err := p.walk(m, fp, depth+1, task, oid, l, v, loc, res); err != nil {
+				return err
+			}
+			continue
+		}
+
+		date, err := time.ParseInLocation(strings.Join(l, "|"), strings.Join(v, "|"), loc)
+		if err != nil {
+			logger.Debug("file does not match path template", "path", fp, "template", p.raw, "error", err)
+			continue
+		}
+		*res = append(*res, storedFile{path: fp, date: date})
+	}
+	return nil
+}
+
+// pattern returns expression which matches name by segment and layouts of its groups
+func (p PathTemplate) pattern(segment, task, oid string) (*regexp.Regexp, []string) {
+	var (
+		expr    strings.Builder
+		layouts = make([]string, 0)
+		pos     = 0
+	)
+	expr.WriteString("^")
+	for _, idx := range placeholderRe.FindAllStringSubmatchIndex(segment, -1) {
+		expr.WriteString(regexp.QuoteMeta(segment[pos:idx[0]]))
+		pos = idx[1]
+
+		name, layout := segment[idx[2]:idx[3]], ""
+		if idx[4] >= 0 {
+			layout = segment[idx[4]:idx[5]]
+		}
+		switch name {
+		case placeholderTask:
+			expr.WriteString(regexp.QuoteMeta(task))
+		case placeholderOID:
+			expr.WriteString(regexp.QuoteMeta(oid))
+		case placeholderHost:
+			expr.WriteString(regexp.QuoteMeta(p.host))
+		case placeholderFile:
+			expr.WriteString(".+")
+		case placeholderTime:
+			layout = timeLayout
+			fallthrough
+		case placeholderDate:
+			expr.WriteString("(" + layoutPattern(layout) + ")")
+			layouts = append(layouts, layout)
+		}
+	}
+	expr.WriteString(regexp.QuoteMeta(segment[pos:]) + "$")
+	return regexp.MustCompile(expr.String()), layouts
+}
+
+// dependsOnRun checks that segment contains date or time of run
+func dependsOnRun(segment string) bool {
+	for _, m := range placeholderRe.FindAllStringSubmatch(segment, -1) {
+		if m[1] == placeholderDate || m[1] == placeholderTime {
+			return true
+		}
+	}
+	return false
+}
+
+// layoutPattern converts layout of date to expression, elements of layout are any letters and digits
+func layoutPattern(layout string) string {
+	var (
+		expr  strings.Builder
+		inRun bool
+	)
+	for _, r := range layout {
+		if r >= '0' && r <= '9' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' {
+			if !inRun {
+				expr.WriteString("[0-9A-Za-z]+")
+				inRun = true
+			}
+			continue
+		}
+		inRun = false
+		expr.WriteString(regexp.QuoteMeta(string(r)))
+	}
+	return expr.String()
+}
+
+// removeOldCopies keeps the newest copies of entity on volume. Copy is set of files with the same date
+func (p PathTemplate) removeOldCopies(m manager.ManagerAtomic, task, oid string, keep int, loc *time.Location) ([]string, error) {
+	files, err := p.find(m, task, oid, loc)
+	if err != nil {
+		return nil, err
+	}
+
+	copies := make(map[time.Time][]string)
+	dates := make([]time.Time, 0)
+	for _, f := range files {
+		if _, ok := copies[f.date]; !ok {
+			dates = append(dates, f.date)
+		}
+		copies[f.date] = append(copies[f.date], f.path)
+	}
+	sort.Slice(dates, func(i, j int) bool { return dates[i].Before(dates[j]) })
+
+	logger.Debug("condition of removing old copies", "keep", keep, "qty", len(dates), "template", p.raw)
+	if len(dates) <= keep {
+		return nil, nil
+	}
+
+	var (
+		removed = make([]string, 0)
+		errs    = make([]error, 0)
+		dirs    = make(map[string]bool)
+	)
+	for _, d := range dates[:len(dates)-keep] {
+		for _, f := range copies[d] {
+			if err := m.Remove(f); err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			removed = append(removed, f)
+			dirs[path.Dir(f)] = true
+		}
+	}
+	return removed, errors.Join(append(errs, pruneDirs(m, dirs))...)
+}
+
+// pruneDirs removes directories which became empty and their empty parents. Root of volume is not removed
+func pruneDirs(m manager.ManagerAtomic, dirs map[string]bool) error {
+	ordered := make([]string, 0, len(dirs))
+	for d := range dirs {
+		ordered = append(ordered, d)
+	}
+	// the deepest directories are checked first
+	sort.Slice(ordered, func(i, j int) bool {
+		return strings.Count(ordered[i], "/") > strings.Count(ordered[j], "/")
+	})
+
+	checked := make(map[string]bool)
+	for _, d := range ordered {
+		for ; d != "." && d != "" && !checked[d]; d = path.Dir(d) {
+			checked[d] = true
+			ls, err := m.Ls(d)
+			if err != nil && !os.IsNotExist(err) {
+				return err
+			}
+			if len(ls) > 0 {
+				break
+			}
+			// volumes without directories do not have directory when the last file was removed
+			if err := m.Remove(d); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -1,6 +1,7 @@
 package entity
 
 import (
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
@@ -12,6 +13,7 @@ import (
 	pgdump "github.com/vilasle/backilli/internal/action/dump/postgresql"
 	pgdb "github.com/vilasle/backilli/internal/database/postgresql"
 	"github.com/vilasle/backilli/internal/period"
+	"github.com/vilasle/backilli/internal/tool/encrypt"
 	"github.com/vilasle/backilli/pkg/fs"
 	"github.com/vilasle/backilli/pkg/fs/manager"
 	"github.com/vilasle/backilli/pkg/logger"
@@ -29,19 +31,29 @@ type postgresEntity struct {
 	backupFiles []string
 	st          time.Time
 	et          time.Time
-	keep        int
+	retention   Retention
 	bckpath     []string
+	uploads     []Upload
 	status      string
+	encryptor   *encrypt.Encryptor
+	layout      PathTemplate
+	repository  bool
+	writePolicy WritePolicy
+	degraded    bool
+	tiering     *Tiering
 	err         error
 }
 
 func newPsqlEntity(conf BuilderConfig) (*postgresEntity, error) {
 	e := postgresEntity{
-		id:       conf.Id,
-		database: conf.Database,
-		compress: conf.Compress,
-		period:   conf.PeriodRule,
-		keep:     conf.Keep,
+		id:         conf.Id,
+		database:   conf.Database,
+		compress:   conf.Compress,
+		period:     conf.PeriodRule,
+		retention:  Retention{Keep: conf.Keep, PerVolume: conf.KeepPerVolume},
+		encryptor:  conf.Encryptor,
+		repository: conf.Repository,
+		tiering:    conf.Tiering,
 	}
 
 	usr, password := conf.DatabaseManager.GetAuth()
@@ -54,6 +66,18 @@ func newPsqlEntity(conf BuilderConfig) (*postgresEntity, error) {
 		SSlMode:  false,
 	}
 	e.fsmngr = conf.FsManagers
+
+	layout, err := NewPathTemplate(conf.PathTemplate)
+	if err != nil {
+		return nil, err
+	}
+	e.layout = layout
+
+	policy, err := NewWritePolicy(conf.WritePolicy, len(conf.FsManagers))
+	if err != nil {
+		return nil, err
+	}
+	e.writePolicy = policy
 	return &e, nil
 }
 
@@ -68,6 +92,8 @@ func (e *postgresEntity) Backup(s EntitySetting, t time.Time) {
 		e.status = execStatusSuccess
 		if e.err != nil {
 			e.status = execStatusErr
+		} else if e.degraded {
+			e.status = execStatusDegraded
 		}
 	}()
 
@@ -97,6 +123,16 @@ func (e *postgresEntity) Backup(s EntitySetting, t time.Time) {
 	}
 
 	dump := pgdump.NewDump(e.database, temp, e.compress, e.cnfconn, excludeTables...)
+	dump.Job = jobName(e)
+	failed := failedVolumes(e, s)
+	if err := checkFreeSpace(e, temp, dump, failed); err != nil {
+		e.err = err
+		return
+	}
+	if err := e.writePolicy.available(e.fsmngr, failed); err != nil {
+		e.err = err
+		return
+	}
 	logger.Debug("starting dumping", "dump", dump)
 	if err := dump.Dump(); err != nil {
 		e.err = err
@@ -131,16 +167,40 @@ func (e *postgresEntity) Backup(s EntitySetting, t time.Time) {
 
 	defer clearTempFile(temp, temp)
 	defer clearTempFile(temp, files...)
-	if e.bckpath, err = moveBackupToDestination(e, t); err != nil {
+
+	if e.encryptor != nil {
+		if e.backupFiles, err = encryptFiles(e.encryptor, files); err != nil {
+			e.err = err
+			return
+		}
+	}
+
+	e.uploads, e.degraded, err = sendBackup(e, e.writePolicy, s.Scheduler, t, writeOptions(e, e.fsmngr, e.retention, t), failed)
+	e.bckpath = uploadedPaths(e.uploads)
+	if err != nil {
 		e.err = err
 		return
 	}
 	runtime.GC()
+	e.moveMatured(t)
 	e.clearOldCopies()
 }
 
+func (e *postgresEntity) moveMatured(t time.Time) {
+	if e.tiering == nil {
+		return
+	}
+	if _, err := moveMatured(e, e.tiering, e.retention, t); err != nil {
+		e.err = errors.Join(e.err, err)
+	}
+}
+
 func (e *postgresEntity) clearOldCopies() {
-	rmd, err := ClearOldCopies(e, e.keep)
+	remove := ClearOldCopies
+	if e.repository {
+		remove = pruneRepositories
+	}
+	rmd, err := remove(e, e.retention)
 	if err != nil {
 		e.err = err
 	} else {
@@ -150,6 +210,32 @@ func (e *postgresEntity) clearOldCopies() {
 	}
 }
 
+func (e *postgresEntity) Skip(reason error) {
+	e.st = time.Now()
+	e.et = e.st
+	e.status = execStatusSkipped
+	e.err = reason
+}
+
+func (e postgresEntity) KeyFingerprint() string {
+	if e.encryptor == nil {
+		return ""
+	}
+	return e.encryptor.Fingerprint()
+}
+
+func (e postgresEntity) PathTemplate() PathTemplate {
+	return e.layout
+}
+
+func (e postgresEntity) Repository() bool {
+	return e.repository
+}
+
+func (e postgresEntity) WritePolicy() WritePolicy {
+	return e.writePolicy
+}
+
 func (e postgresEntity) Err() error {
 	return e.err
 }
@@ -201,3 +287,7 @@ func (e postgresEntity) Status() string {
 func (e postgresEntity) BackupPaths() []string {
 	return e.bckpath
 }
+
+func (e postgresEntity) Uploads() []Upload {
+	return e.uploads
+}
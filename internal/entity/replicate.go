@@ -0,0 +1,188 @@
+package entity
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"time"
+
+	"github.com/vilasle/backilli/pkg/fs/manager"
+	"github.com/vilasle/backilli/pkg/fs/unit"
+	"github.com/vilasle/backilli/pkg/logger"
+	"github.com/vilasle/backilli/pkg/repository"
+)
+
+// Replica - result of copying of file of backup between volumes
+type Replica struct {
+	Path string
+	Size int64
+	// Skipped - file is on target already with the same content
+	Skipped bool
+	Err     error
+}
+
+// Replicate copies backups of entity from one volume to other. Copies are found by path template of entity
+// or in repository if entity stores backups there. Files which are on target with the same content are skipped
+func Replicate(e EntityInfo, from, to manager.ManagerAtomic) ([]Replica, error) {
+	if e.Repository() {
+		return replicateRepository(e, from, to)
+	}
+
+	files, err := e.PathTemplate().find(from, e.Id(), e.OID(), time.Local)
+	if err != nil {
+		return nil, errors.Join(err, fmt.Errorf("could not find backups of %s on volume %s", e.OID(), manager.VolumeId(from)))
+	}
+
+	res := make([]Replica, 0, len(files))
+	errs := make([]error, 0)
+	for _, f := range files {
+		r := replicateFile(from, to, f.path)
+		if r.Err != nil {
+			errs = append(errs, r.Err)
+		}
+		res = append(res, r)
+	}
+	return res, errors.Join(errs...)
+}
+
+func replicateFile(from, to manager.ManagerAtomic, p string) Replica {
+	r := Replica{Path: p}
+
+	exists, err := existsOn(to, p)
+	if err != nil {
+		r.Err = err
+		return r
+	}
+
+	// checksum is computed before copying, so size of file is known for writing and content is never loaded into memory
+	sum, err := checksumOf(from, p)
+	if err != nil {
+		r.Err = errors.Join(err, fmt.Errorf("could not read %s from volume %s", p, manager.VolumeId(from)))
+		return r
+	}
+	r.Size = sum.Size
+
+	if exists {
+		if r.Skipped, r.Err = sameContent(to, p, sum); r.Err != nil || r.Skipped {
+			return r
+		}
+	}
+
+	logger.Debug("replicating file", "path", p, "from", manager.VolumeId(from), "to", manager.VolumeId(to))
+	src := &volumeFile{m: from, path: p}
+	defer src.Close()
+	if _, _, err := manager.WriteWithRetries(to, src, p, unit.WriteOptions{Size: sum.Size}); err != nil {
+		r.Err = errors.Join(err, fmt.Errorf("could not write %s to volume %s", p, manager.VolumeId(to)))
+		return r
+	}
+	// file is read back from volume which does not verify files, so source can be removed after copying
+	if same, err := sameContent(to, p, sum); err != nil || !same {
+		r.Err = errors.Join(err, fmt.Errorf("verification of %s on volume %s failed", p, manager.VolumeId(to)))
+	}
+	return r
+}
+
+// checksumOf streams file of volume and calculates its checksum
+func checksumOf(m manager.ManagerAtomic, p string) (unit.Checksum, error) {
+	rc, err := m.Open(p)
+	if err != nil {
+		return unit.Checksum{}, err
+	}
+	defer rc.Close()
+	return unit.ComputeChecksum(rc)
+}
+
+// volumeFile streams file of volume. File is opened again when writing is repeated from the beginning
+type volumeFile struct {
+	m      manager.ManagerAtomic
+	path   string
+	rc     io.ReadCloser
+	offset int64
+}
+
+func (f *volumeFile) Read(p []byte) (int, error) {
+	if f.rc == nil {
+		rc, err := f.m.Open(f.path)
+		if err != nil {
+			return 0, err
+		}
+		f.rc = rc
+	}
+	n, err := f.rc.Read(p)
+	f.offset += int64(n)
+	return n, err
+}
+
+// Seek reports current offset and rewinds file to the beginning only
+func (f *volumeFile) Seek(offset int64, whence int) (int64, error) {
+	switch {
+	case offset == 0 && whence == io.SeekCurrent:
+		return f.offset, nil
+	case offset == 0 && whence == io.SeekStart:
+		err := f.Close()
+		f.offset = 0
+		return 0, err
+	default:
+		return f.offset, fmt.Errorf("file %s of volume %s can be rewound to the beginning only", f.path, manager.VolumeId(f.m))
+	}
+}
+
+func (f *volumeFile) Close() error {
+	if f.rc == nil {
+		return nil
+	}
+	err := f.rc.Close()
+	f.rc = nil
+	return err
+}
+
+// existsOn checks that directory of volume contains file
+func existsOn(m manager.ManagerAtomic, p string) (bool, error) {
+	ls, err := m.Ls(path.Dir(p))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	for _, f := range ls {
+		if f.Name == path.Base(p) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// sameContent compares file on volume with checksum, file is read if volume does not verify files
+func sameContent(m manager.ManagerAtomic, p string, sum unit.Checksum) (bool, error) {
+	err := manager.Verify(m, p, sum)
+	if !errors.Is(err, manager.ErrUnverifiable) {
+		return err == nil, nil
+	}
+
+	target, err := checksumOf(m, p)
+	if err != nil {
+		return false, err
+	}
+	return target.SHA256 == sum.SHA256, nil
+}
+
+func replicateRepository(e EntityInfo, from, to manager.ManagerAtomic) ([]Replica, error) {
+	src, err := repository.New(from, repository.DefaultParams)
+	if err != nil {
+		return nil, err
+	}
+	dst, err := repository.New(to, repository.DefaultParams)
+	if err != nil {
+		return nil, err
+	}
+
+	copied, err := repository.Replicate(src, dst, e.Id(), e.OID())
+	res := make([]Replica, 0, len(copied))
+	for _, c := range copied {
+		res = append(res, Replica{Path: c.Path, Size: c.Size, Skipped: c.Skipped})
+	}
+	return res, err
+}
@@ -0,0 +1,107 @@
+package entity
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/vilasle/backilli/pkg/fs/manager"
+	"github.com/vilasle/backilli/pkg/logger"
+	"github.com/vilasle/backilli/pkg/repository"
+)
+
+// storeInRepositories saves files of backup as snapshot of repository on every of volumes.
+// Result of every file on every volume refers to snapshot
+func storeInRepositories(e EntityInfo, volumes []manager.ManagerAtomic, sch *UploadScheduler, t time.Time) ([]Upload, error) {
+	if sch == nil {
+		sch = NewUploadScheduler(0, 0)
+	}
+
+	pack, err := createPackage(e.BackupFilePath())
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		mx      = &sync.Mutex{}
+		wg      = &sync.WaitGroup{}
+		uploads = make([]Upload, 0, len(pack)*len(volumes))
+		errs    = make([]error, 0)
+	)
+	for _, m := range volumes {
+		wg.Add(1)
+		go func(m manager.ManagerAtomic) {
+			defer wg.Done()
+
+			var (
+				snapshot string
+				stats    repository.Stats
+				err      error
+			)
+			sch.run(manager.VolumeId(m), func() {
+				snapshot, stats, err = storeInRepository(m, e, t)
+			})
+			if err == nil {
+				logger.Info("snapshot was stored in repository",
+					"volume", manager.VolumeId(m),
+					"snapshot", snapshot,
+					"chunks", stats.Chunks,
+					"new chunks", stats.NewChunks,
+					"new bytes", stats.NewBytes)
+			}
+
+			mx.Lock()
+			defer mx.Unlock()
+			if err != nil {
+				errs = append(errs, err)
+			}
+			for _, it := range pack {
+				u := Upload{Volume: manager.VolumeId(m), File: it.name, SHA256: it.sum.SHA256}
+				if err != nil {
+					u.Err = err
+				} else {
+					u.Path, u.Verified = snapshot, stats.Verified
+				}
+				uploads = append(uploads, u)
+			}
+		}(m)
+	}
+	wg.Wait()
+
+	return uploads, errors.Join(errs...)
+}
+
+func storeInRepository(m manager.ManagerAtomic, e EntityInfo, t time.Time) (string, repository.Stats, error) {
+	repo, err := repository.New(m, repository.DefaultParams)
+	if err != nil {
+		return "", repository.Stats{}, err
+	}
+	snapshot, stats, err := repo.Store(e.Id(), e.OID(), t, e.BackupFilePath())
+	if err != nil {
+		return "", stats, errors.Join(err, fmt.Errorf("could not store snapshot in repository on volume %s", manager.VolumeId(m)))
+	}
+	return snapshot, stats, nil
+}
+
+// pruneRepositories keeps the newest snapshots of entity by retention of volume
+// and removes chunks which are not used anymore
+func pruneRepositories(e EntityInfo, r Retention) ([]string, error) {
+	removed := make([]string, 0)
+	errs := make([]error, 0)
+	for _, m := range e.FileManagers() {
+		if failedOn(e, m) {
+			continue
+		}
+		repo, err := repository.New(m, repository.DefaultParams)
+		if err != nil {
+			return nil, err
+		}
+		rmd, err := repo.Prune(e.Id(), e.OID(), r.KeepOn(manager.VolumeId(m)))
+		removed = append(removed, rmd...)
+		if err != nil {
+			errs = append(errs, errors.Join(err, fmt.Errorf("could not prune repository on volume %s", manager.VolumeId(m))))
+		}
+	}
+	return removed, errors.Join(errs...)
+}
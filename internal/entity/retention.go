@@ -0,0 +1,34 @@
+package entity
+
+import (
+	"time"
+
+	"github.com/vilasle/backilli/pkg/fs/manager"
+	"github.com/vilasle/backilli/pkg/fs/unit"
+)
+
+// Retention - how many copies of entity are kept on volumes.
+// PerVolume overrides Keep for volume with id, so fast local disk and cold storage can keep different count
+type Retention struct {
+	Keep      int
+	PerVolume map[string]int
+}
+
+// KeepOn returns count of copies which are kept on volume
+func (r Retention) KeepOn(volume string) int {
+	if keep, ok := r.PerVolume[volume]; ok {
+		return keep
+	}
+	return r.Keep
+}
+
+// writeOptions returns options of writing copy made at t to every volume of entity.
+// Copy is locked till it is removed by retention of volume
+func writeOptions(e Entity, volumes []manager.ManagerAtomic, r Retention, t time.Time) map[string]unit.WriteOptions {
+	opts := make(map[string]unit.WriteOptions, len(volumes))
+	for _, m := range volumes {
+		id := manager.VolumeId(m)
+		opts[id] = unit.WriteOptions{RetainUntil: retainUntil(e, r.KeepOn(id), t)}
+	}
+	return opts
+}
@@ -0,0 +1,117 @@
+package entity
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/vilasle/backilli/pkg/fs/manager"
+	"github.com/vilasle/backilli/pkg/fs/unit"
+)
+
+// DefaultUploadsPerVolume - limit of concurrent uploads to one volume if it is not defined
+const DefaultUploadsPerVolume = 4
+
+// UploadScheduler limits concurrent uploads of files of backups.
+// Global limit is common for all volumes, per-volume limit is applied to every volume.
+// One scheduler is shared by entities of process
+type UploadScheduler struct {
+	global    chan struct{}
+	perVolume int
+	mx        sync.Mutex
+	volumes   map[string]chan struct{}
+}
+
+// NewUploadScheduler - global is unlimited if it is not positive,
+// DefaultUploadsPerVolume is used if perVolume is not positive
+func NewUploadScheduler(global, perVolume int) *UploadScheduler {
+	s := &UploadScheduler{
+		perVolume: perVolume,
+		volumes:   make(map[string]chan struct{}),
+	}
+	if s.perVolume <= 0 {
+		s.perVolume = DefaultUploadsPerVolume
+	}
+	if global > 0 {
+		s.global = make(chan struct{}, global)
+	}
+	return s
+}
+
+// uploadTo sends every file of pack to every of volumes with options of volume.
+// It returns result of every file on every volume
+func (s *UploadScheduler) uploadTo(e EntityInfo, volumes []manager.ManagerAtomic, pack []packItem, t time.Time, opts map[string]unit.WriteOptions) []Upload {
+	var (
+		mx      = &sync.Mutex{}
+		wg      = &sync.WaitGroup{}
+		uploads = make([]Upload, 0, len(pack)*len(volumes))
+	)
+	for _, m := range volumes {
+		queue := make(chan packItem, len(pack))
+		for _, it := range pack {
+			queue <- it
+		}
+		close(queue)
+
+		// workers of volume are bounded, so big backup does not create goroutine for every file
+		sem := s.volume(manager.VolumeId(m))
+		for i := 0; i < min(s.perVolume, len(pack)); i++ {
+			wg.Add(1)
+			go func(m manager.ManagerAtomic) {
+				defer wg.Done()
+				for it := range queue {
+					release := s.acquire(sem)
+					u := sendFile(m, e, t, it, opts[manager.VolumeId(m)])
+					release()
+
+					mx.Lock()
+					uploads = append(uploads, u)
+					mx.Unlock()
+				}
+			}(m)
+		}
+	}
+	wg.Wait()
+
+	sort.Slice(uploads, func(i, j int) bool {
+		if uploads[i].File != uploads[j].File {
+			return uploads[i].File < uploads[j].File
+		}
+		return uploads[i].Volume < uploads[j].Volume
+	})
+	return uploads
+}
+
+// run executes fn in slot of volume
+func (s *UploadScheduler) run(volume string, fn func()) {
+	release := s.acquire(s.volume(volume))
+	defer release()
+	fn()
+}
+
+// volume returns semaphore of volume, it is shared by all uploads to the volume
+func (s *UploadScheduler) volume(id string) chan struct{} {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	sem, ok := s.volumes[id]
+	if !ok {
+		sem = make(chan struct{}, s.perVolume)
+		s.volumes[id] = sem
+	}
+	return sem
+}
+
+// acquire takes slot of volume then global slot, the same order everywhere prevents deadlocks
+func (s *UploadScheduler) acquire(sem chan struct{}) (release func()) {
+	sem <- struct{}{}
+	if s.global != nil {
+		s.global <- struct{}{}
+	}
+	return func() {
+		if s.global != nil {
+			<-s.global
+		}
+		<-sem
+	}
+}
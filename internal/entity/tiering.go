@@ -0,0 +1,103 @@
+package entity
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"sort"
+	"time"
+
+	"github.com/vilasle/backilli/pkg/fs/manager"
+	"github.com/vilasle/backilli/pkg/logger"
+)
+
+// Tiering - copies of entity which are older than After are moved from volumes of entity to colder volume MoveTo
+type Tiering struct {
+	After  time.Duration
+	MoveTo manager.ManagerAtomic
+}
+
+// moveMatured moves copies which are older than After at t from every volume of entity to colder volume.
+// Copies are found and dated by path template of entity as ClearOldCopies does. Copy is removed from volume
+// when every file of copy is written to colder volume and verified. Copies on colder volume are cleared
+// if retention defines count of copies for it
+func moveMatured(e EntityInfo, tr *Tiering, r Retention, t time.Time) ([]Replica, error) {
+	cold := manager.VolumeId(tr.MoveTo)
+
+	res := make([]Replica, 0)
+	errs := make([]error, 0)
+	for _, m := range e.FileManagers() {
+		if manager.VolumeId(m) == cold || failedOn(e, m) {
+			continue
+		}
+		moved, err := moveMaturedFrom(e, m, tr, t)
+		res = append(res, moved...)
+		if err != nil {
+			errs = append(errs, errors.Join(err, fmt.Errorf("could not move copies from volume %s to %s", manager.VolumeId(m), cold)))
+		}
+	}
+
+	if keep, ok := r.PerVolume[cold]; ok {
+		rmd, err := e.PathTemplate().removeOldCopies(tr.MoveTo, e.Id(), e.OID(), keep, time.Local)
+		for _, v := range rmd {
+			logger.Info("removed", "file", v, "volume", cold)
+		}
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return res, errors.Join(errs...)
+}
+
+func moveMaturedFrom(e EntityInfo, m manager.ManagerAtomic, tr *Tiering, t time.Time) ([]Replica, error) {
+	files, err := e.PathTemplate().find(m, e.Id(), e.OID(), time.Local)
+	if err != nil {
+		return nil, err
+	}
+
+	copies := make(map[time.Time][]string)
+	dates := make([]time.Time, 0)
+	for _, f := range files {
+		if t.Sub(f.date) < tr.After {
+			continue
+		}
+		if _, ok := copies[f.date]; !ok {
+			dates = append(dates, f.date)
+		}
+		copies[f.date] = append(copies[f.date], f.path)
+	}
+	sort.Slice(dates, func(i, j int) bool { return dates[i].Before(dates[j]) })
+
+	var (
+		res  = make([]Replica, 0)
+		errs = make([]error, 0)
+		dirs = make(map[string]bool)
+	)
+	for _, d := range dates {
+		replicas := make([]Replica, 0, len(copies[d]))
+		moved := true
+		for _, p := range copies[d] {
+			r := replicateFile(m, tr.MoveTo, p)
+			if r.Err != nil {
+				errs = append(errs, r.Err)
+				moved = false
+			}
+			replicas = append(replicas, r)
+		}
+		res = append(res, replicas...)
+
+		// copy is kept on volume till every its file is on colder volume
+		if !moved {
+			continue
+		}
+		for _, p := range copies[d] {
+			if err := m.Remove(p); err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			logger.Info("moved to colder volume", "file", p, "from", manager.VolumeId(m), "to", manager.VolumeId(tr.MoveTo))
+			dirs[path.Dir(p)] = true
+		}
+	}
+	return res, errors.Join(append(errs, pruneDirs(m, dirs))...)
+}
@@ -0,0 +1,207 @@
+package entity
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/vilasle/backilli/pkg/fs/manager"
+	"github.com/vilasle/backilli/pkg/logger"
+)
+
+const (
+	// WriteAll - backup has to be written to every volume
+	WriteAll = "all"
+	// WriteQuorum - backup has to be written to N volumes at least ("quorum 2")
+	WriteQuorum = "quorum"
+	// WriteFirstAvailable - backup is written to the first volume which accepts it. Volumes are tried in order
+	// of volumes of task (FileManagers), so this order is order of failover
+	WriteFirstAvailable = "first-available"
+)
+
+// VolumeResult - result of writing backup to volume of entity
+type VolumeResult struct {
+	Volume string
+	// Written - every file of backup was written to volume
+	Written bool
+	// Attempted - volume was used, it is false for volumes which were not needed by policy "first-available"
+	Attempted bool
+	Err       error
+}
+
+// WritePolicy - which volumes of entity have to receive backup for success of backup.
+// Backup which satisfies policy, but was not written to some volumes, gets status "degraded"
+type WritePolicy struct {
+	raw    string
+	mode   string
+	quorum int
+}
+
+// NewWritePolicy parses policy "all", "quorum N" or "first-available", empty policy is "all".
+// Quorum can not be more than count of volumes
+func NewWritePolicy(policy string, volumes int) (WritePolicy, error) {
+	p := WritePolicy{raw: policy, mode: WriteAll}
+
+	fields := strings.Fields(policy)
+	if len(fields) == 0 {
+		return p, nil
+	}
+	p.mode = fields[0]
+
+	switch {
+	case p.mode == WriteQuorum && len(fields) == 2:
+		n, err := strconv.Atoi(fields[1])
+		if err != nil || n <= 0 {
+			return p, fmt.Errorf("unexpected quorum of write policy '%s'", policy)
+		}
+		if n > volumes {
+			return p, fmt.Errorf("quorum of write policy '%s' is more than count of volumes %d", policy, volumes)
+		}
+		p.quorum = n
+	case (p.mode == WriteAll || p.mode == WriteFirstAvailable) && len(fields) == 1:
+	default:
+		return p, fmt.Errorf("unexpected write policy '%s'", policy)
+	}
+	return p, nil
+}
+
+func (p WritePolicy) String() string {
+	if p.raw == "" {
+		return WriteAll
+	}
+	return p.raw
+}
+
+// Enough reports that backup which is written to written of total volumes satisfies policy
+func (p WritePolicy) Enough(written, total int) bool {
+	switch p.mode {
+	case WriteQuorum:
+		return written >= p.quorum
+	case WriteFirstAvailable:
+		return written > 0
+	default:
+		return written == total
+	}
+}
+
+// available checks that policy can be satisfied without volumes of failed which can not receive backup
+func (p WritePolicy) available(volumes []manager.ManagerAtomic, failed map[string]error) error {
+	errs := make([]error, 0)
+	for _, m := range volumes {
+		if err, ok := failed[manager.VolumeId(m)]; ok {
+			errs = append(errs, err)
+		}
+	}
+	if len(errs) == 0 {
+		return nil
+	}
+	if !p.Enough(len(volumes)-len(errs), len(volumes)) {
+		return errors.Join(errs...)
+	}
+	logger.Warn("backup is written to volumes which can receive it", "policy", p.String(), "error", errors.Join(errs...))
+	return nil
+}
+
+// write sends backup to volumes by policy. send writes backup to volumes and returns result of every file on every volume.
+// Volumes of failed are not used, they are failed targets of policy.
+// Volumes are tried one by one for policy "first-available" till backup is written.
+// It returns true if policy is satisfied, but backup was not written to some of used volumes
+func (p WritePolicy) write(volumes []manager.ManagerAtomic, failed map[string]error, send func([]manager.ManagerAtomic) ([]Upload, error)) ([]Upload, bool, error) {
+	uploads := make([]Upload, 0)
+	targets := make([]manager.ManagerAtomic, 0, len(volumes))
+	for _, m := range volumes {
+		if err, ok := failed[manager.VolumeId(m)]; ok {
+			uploads = append(uploads, Upload{Volume: manager.VolumeId(m), Err: err})
+			continue
+		}
+		targets = append(targets, m)
+	}
+
+	if p.mode != WriteFirstAvailable {
+		if len(targets) > 0 {
+			res, err := send(targets)
+			if len(res) == 0 && err != nil {
+				return nil, false, err
+			}
+			uploads = append(uploads, res...)
+		}
+		return p.check(volumes, uploads)
+	}
+
+	for _, m := range targets {
+		res, err := send([]manager.ManagerAtomic{m})
+		if len(res) == 0 && err != nil {
+			return uploads, false, err
+		}
+		uploads = append(uploads, res...)
+		if volumeResult(m, res).Written {
+			break
+		}
+		logger.Warn("backup was not written to volume, the next volume is used", "volume", manager.VolumeId(m), "error", err)
+	}
+	return p.check(volumes, uploads)
+}
+
+func (p WritePolicy) check(volumes []manager.ManagerAtomic, uploads []Upload) ([]Upload, bool, error) {
+	var written, attempted int
+	errs := make([]error, 0)
+	for _, m := range volumes {
+		r := volumeResult(m, uploads)
+		if r.Written {
+			written++
+		}
+		if r.Attempted {
+			attempted++
+		}
+		if r.Err != nil {
+			errs = append(errs, r.Err)
+		}
+	}
+
+	if !p.Enough(written, len(volumes)) {
+		if p.mode == WriteAll {
+			return uploads, false, errors.Join(errs...)
+		}
+		errs = append([]error{fmt.Errorf("backup was written to %d of %d volumes, write policy '%s' is not satisfied",
+			written, len(volumes), p)}, errs...)
+		return uploads, false, errors.Join(errs...)
+	}
+	return uploads, written < attempted, nil
+}
+
+// VolumeResults returns result of writing backup of entity to every volume of entity
+func VolumeResults(e EntityInfo) []VolumeResult {
+	res := make([]VolumeResult, 0, len(e.FileManagers()))
+	for _, m := range e.FileManagers() {
+		res = append(res, volumeResult(m, e.Uploads()))
+	}
+	return res
+}
+
+// failedOn reports that the last backup of entity was not written to volume, old copies are kept there
+func failedOn(e EntityInfo, m manager.ManagerAtomic) bool {
+	r := volumeResult(m, e.Uploads())
+	if r.Attempted && !r.Written {
+		logger.Warn("backup was not written to volume, old copies are kept", "task", e.Id(), "volume", r.Volume)
+		return true
+	}
+	return false
+}
+
+func volumeResult(m manager.ManagerAtomic, uploads []Upload) VolumeResult {
+	r := VolumeResult{Volume: manager.VolumeId(m)}
+	errs := make([]error, 0)
+	for _, u := range uploads {
+		if u.Volume != r.Volume {
+			continue
+		}
+		r.Attempted = true
+		if u.Err != nil {
+			errs = append(errs, u.Err)
+		}
+	}
+	r.Err = errors.Join(errs...)
+	r.Written = r.Attempted && r.Err == nil
+	return r
+}
@@ -0,0 +1,129 @@
+package process
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	cfg "github.com/vilasle/backilli/internal/config"
+	"github.com/vilasle/backilli/pkg/fs/manager"
+	"github.com/vilasle/backilli/pkg/fs/unit"
+	"github.com/vilasle/backilli/pkg/logger"
+)
+
+// directory of probe under root of volume
+const probeDir = ".backilli-probe"
+
+// VolumeCheck - result of preflight check of volume
+type VolumeCheck struct {
+	Id      string
+	Latency time.Duration
+	Err     error
+}
+
+func (c VolumeCheck) Healthy() bool {
+	return c.Err == nil
+}
+
+// CheckVolumes connects to every volume from config and checks it.
+// Unlike InitProcess it does not stop on the first volume which is not available
+func CheckVolumes(conf cfg.ProcessConfig) ([]VolumeCheck, error) {
+	if err := conf.SetEnvironment(); err != nil {
+		return nil, errors.Join(err, errors.New("could not set environment vars"))
+	}
+
+	configs, err := convertConfigForFSManagers(conf.Volumes)
+	if err != nil {
+		return nil, err
+	}
+
+	res := make([]VolumeCheck, 0, len(configs))
+	for _, c := range configs {
+		st := time.Now()
+		m, err := manager.NewManager(c)
+		if err != nil {
+			res = append(res, VolumeCheck{
+				Id:      c.Id,
+				Latency: time.Since(st),
+				Err:     errors.Join(err, fmt.Errorf("could not connect to volume %s", c.Id)),
+			})
+			continue
+		}
+
+		check := checkVolume(c.Id, m)
+		check.Latency = time.Since(st)
+		if err := m.Close(); err != nil {
+			logger.Warn("could not close volume", "volume", c.Id, "error", err)
+		}
+		res = append(res, check)
+	}
+	return res, nil
+}
+
+// CheckVolumes checks volumes which are connected already
+func (ps *Process) CheckVolumes() []VolumeCheck {
+	ids := make([]string, 0, len(ps.volumes))
+	for id := range ps.volumes {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	res := make([]VolumeCheck, 0, len(ids))
+	for _, id := range ids {
+		res = append(res, checkVolume(id, ps.volumes[id]))
+	}
+	return res
+}
+
+// checkVolume writes probe under root of volume, lists it, reads it back and removes it
+func checkVolume(id string, m manager.ManagerAtomic) (check VolumeCheck) {
+	var (
+		st      = time.Now()
+		name    = fmt.Sprintf("%d.probe", st.UnixNano())
+		dst     = probeDir + "/" + name
+		content = []byte("backilli probe " + st.Format(time.RFC3339Nano))
+	)
+	check.Id = id
+
+	logger.Debug("checking volume", "volume", id)
+	defer func() {
+		check.Latency = time.Since(st)
+	}()
+
+	path, err := m.Write(bytes.NewReader(content), dst, unit.WriteOptions{Size: int64(len(content))})
+	if err != nil {
+		check.Err = errors.Join(err, fmt.Errorf("could not write probe to volume %s", id))
+		return
+	}
+	defer func() {
+		if err := m.Remove(probeDir); err != nil && check.Err == nil {
+			check.Err = errors.Join(err, fmt.Errorf("could not remove probe from volume %s", id))
+		}
+	}()
+
+	ls, err := m.Ls(probeDir)
+	if err != nil {
+		check.Err = errors.Join(err, fmt.Errorf("could not list probe on volume %s", id))
+		return
+	}
+	found := false
+	for _, f := range ls {
+		found = found || f.Name == name
+	}
+	if !found {
+		check.Err = fmt.Errorf("probe %s is not listed on volume %s", name, id)
+		return
+	}
+
+	res, err := m.Read(path)
+	if err != nil {
+		check.Err = errors.Join(err, fmt.Errorf("could not read probe from volume %s", id))
+		return
+	}
+	if !bytes.Equal(res, content) {
+		check.Err = fmt.Errorf("content of probe on volume %s does not match", id)
+	}
+	return
+}
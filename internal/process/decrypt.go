@@ -0,0 +1,70 @@
+package process
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	cfg "github.com/vilasle/backilli/internal/config"
+	"github.com/vilasle/backilli/internal/tool/encrypt"
+)
+
+// Decrypt reads encrypted backup and writes decrypted content to dst. Backup is read from volume
+// with volumeId (path as it is in report) or from local file if volumeId is empty.
+// identityFile contains secret keys of age
+func Decrypt(conf cfg.ProcessConfig, volumeId, path, identityFile string, dst io.Writer) error {
+	identities, err := encrypt.LoadIdentities(identityFile)
+	if err != nil {
+		return err
+	}
+
+	var src io.Reader
+	if volumeId == "" {
+		fd, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer fd.Close()
+		src = fd
+	} else {
+		rc, err := openOnVolume(conf, volumeId, path)
+		if err != nil {
+			return err
+		}
+		defer rc.Close()
+		src = rc
+	}
+
+	if err := encrypt.Decrypt(dst, src, identities...); err != nil {
+		return errors.Join(err, fmt.Errorf("could not decrypt %s", path))
+	}
+	return nil
+}
+
+// openOnVolume streams file of volume, volume is closed with file
+func openOnVolume(conf cfg.ProcessConfig, volumeId, path string) (io.ReadCloser, error) {
+	if err := conf.SetEnvironment(); err != nil {
+		return nil, errors.Join(err, errors.New("could not set environment vars"))
+	}
+
+	m, err := connectVolume(conf, volumeId)
+	if err != nil {
+		return nil, err
+	}
+	rc, err := m.Open(path)
+	if err != nil {
+		m.Close()
+		return nil, err
+	}
+	return volumeFile{ReadCloser: rc, volume: m}, nil
+}
+
+type volumeFile struct {
+	io.ReadCloser
+	volume io.Closer
+}
+
+func (f volumeFile) Close() error {
+	return errors.Join(f.ReadCloser.Close(), f.volume.Close())
+}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"strconv"
 	"strings"
+	"time"
 
 	"errors"
 
@@ -16,14 +17,9 @@ import (
 
 func (pc *Process) setEntityFromTask(tasks []cfg.Task) error {
 	for _, v := range tasks {
-		rule := period.PeriodRule{}
-		switch v.Type {
-		case period.DAILY:
-			rule.Day = period.NewWeekdaysRule(v.Repeat)
-		case period.MONTHLY:
-			rule.Month = period.NewMonthRule(v.Repeat, period.PartOfMonth(v.PartOfMonth))
-		default:
-			return errors.New("unexpected type of period")
+		rule, err := periodRule(v)
+		if err != nil {
+			return err
 		}
 
 		volumes := make([]manager.ManagerAtomic, 0)
@@ -37,6 +33,15 @@ func (pc *Process) setEntityFromTask(tasks []cfg.Task) error {
 		if err != nil {
 			return errors.Join(err, fmt.Errorf("there are errors on creation config tasks"))
 		}
+		if v.Tiering.Enabled() {
+			tiering, err := pc.tiering(v.Tiering)
+			if err != nil {
+				return errors.Join(err, fmt.Errorf("could not init tiering of task %s", v.Id))
+			}
+			for i := range cs {
+				cs[i].Tiering = tiering
+			}
+		}
 		es, err := entity.CreateAllEntities(cs)
 		if err != nil {
 			return errors.Join(err, fmt.Errorf("could not create backup entity from config %v", cs))
@@ -46,6 +51,38 @@ func (pc *Process) setEntityFromTask(tasks []cfg.Task) error {
 	return nil
 }
 
+func (pc *Process) tiering(t cfg.Tiering) (*entity.Tiering, error) {
+	m, ok := pc.volumes[t.MoveTo]
+	if !ok {
+		return nil, fmt.Errorf("volume %s is not defined", t.MoveTo)
+	}
+	after, err := parseAge(t.After)
+	if err != nil {
+		return nil, err
+	}
+	return &entity.Tiering{After: after, MoveTo: m}, nil
+}
+
+func periodRule(task cfg.Task) (period.PeriodRule, error) {
+	rule := period.PeriodRule{}
+	switch task.Type {
+	case period.DAILY:
+		rule.Day = period.NewWeekdaysRule(task.Repeat)
+	case period.MONTHLY:
+		rule.Month = period.NewMonthRule(task.Repeat, period.PartOfMonth(task.PartOfMonth))
+	default:
+		return rule, errors.New("unexpected type of period")
+	}
+	return rule, nil
+}
+
+// ports which are used when address of volume does not contain port
+var defaultPorts = map[string]int{
+	cfg.SMBVolume:  445,
+	cfg.SFTPVolume: 22,
+	cfg.FTPVolume:  21,
+}
+
 func convertConfigForFSManagers(ms []cfg.VolumeConfig) ([]unit.ClientConfig, error) {
 	res := make([]unit.ClientConfig, 0, len(ms))
 	for _, v := range ms {
@@ -60,17 +97,51 @@ func convertConfigForFSManagers(ms []cfg.VolumeConfig) ([]unit.ClientConfig, err
 		c.KeyId = v.KeyId
 		c.KeySecret = v.KeySecret
 		c.Region = v.Region
-		if v.Type == cfg.SMBVolume {
+		c.Endpoint = v.Endpoint
+		c.PathStyle = v.PathStyle
+		c.InsecureSkipVerify = v.InsecureSkipVerify
+		c.PrivateKey = v.PrivateKey
+		c.Passphrase = v.Passphrase
+		c.KnownHosts = v.KnownHosts
+		c.TLSMode = v.TLSMode
+		c.DisableEPSV = v.DisableEPSV
+		c.StorageClass = v.StorageClass
+		c.SSE = v.SSE.Type
+		c.SSEKMSKeyId = v.SSE.KMSKeyId
+		c.ObjectLockMode = v.ObjectLockMode
+		c.Commands = unit.CommandTemplates{
+			Write:         v.Commands.Write,
+			Read:          v.Commands.Read,
+			Ls:            v.Commands.Ls,
+			Remove:        v.Commands.Remove,
+			NotExistCodes: v.Commands.NotExistCodes,
+		}
+		if retry, err := convertRetryPolicy(v.Retry); err == nil {
+			c.Retry = retry
+		} else {
+			return nil, errors.Join(err, fmt.Errorf("does not convert retry policy of volume %s", v.Id))
+		}
+		if bandwidth, err := convertBandwidthPolicy(v.MaxBandwidth, v.BandwidthSchedule); err == nil {
+			c.Bandwidth = bandwidth
+		} else {
+			return nil, errors.Join(err, fmt.Errorf("does not convert bandwidth of volume %s", v.Id))
+		}
+		if quota, err := parseSize(v.Quota); err == nil {
+			c.Quota = quota
+		} else {
+			return nil, errors.Join(err, fmt.Errorf("does not convert quota of volume %s", v.Id))
+		}
+		if port, ok := defaultPorts[v.Type]; ok {
 			socket := strings.Split(v.Address, ":")
 			c.Host = socket[0]
 			if len(socket) != 2 {
-				c.Port = 445
+				c.Port = port
 			} else {
 				if p, err := strconv.Atoi(socket[1]); err == nil {
 					c.Port = p
 				} else {
 					return nil, errors.Join(err, fmt.Errorf(
-						"does not convert smb socket %s to expected type", v.Address))
+						"does not convert %s socket %s to expected type", v.Type, v.Address))
 				}
 			}
 		}
@@ -82,6 +153,18 @@ func convertConfigForFSManagers(ms []cfg.VolumeConfig) ([]unit.ClientConfig, err
 			c.Type = manager.SMB
 		case cfg.YandexStorageVolume:
 			c.Type = manager.YANDEX
+		case cfg.S3Volume:
+			c.Type = manager.S3
+		case cfg.SFTPVolume:
+			c.Type = manager.SFTP
+		case cfg.FTPVolume:
+			c.Type = manager.FTP
+		case cfg.WebDAVVolume:
+			c.Type = manager.WEBDAV
+		case cfg.MemoryVolume:
+			c.Type = manager.MEMORY
+		case cfg.CommandVolume:
+			c.Type = manager.COMMAND
 		default:
 			return nil, errors.New("unexpected type of volume")
 		}
@@ -90,6 +173,113 @@ func convertConfigForFSManagers(ms []cfg.VolumeConfig) ([]unit.ClientConfig, err
 	return res, nil
 }
 
+func convertRetryPolicy(r cfg.Retry) (unit.RetryPolicy, error) {
+	policy := unit.RetryPolicy{Attempts: r.Attempts, Jitter: r.Jitter}
+	if r.Jitter < 0 || r.Jitter > 1 {
+		return policy, fmt.Errorf("jitter %v is out of range 0..1", r.Jitter)
+	}
+
+	var err error
+	if r.Delay != "" {
+		if policy.Delay, err = time.ParseDuration(r.Delay); err != nil {
+			return policy, err
+		}
+	}
+	if r.MaxDelay != "" {
+		if policy.MaxDelay, err = time.ParseDuration(r.MaxDelay); err != nil {
+			return policy, err
+		}
+	}
+	return policy, nil
+}
+
+func convertBandwidthPolicy(limit string, schedule []cfg.BandwidthWindow) (unit.BandwidthPolicy, error) {
+	var (
+		policy unit.BandwidthPolicy
+		err    error
+	)
+	if policy.Limit, err = parseSize(limit); err != nil {
+		return policy, err
+	}
+
+	for _, w := range schedule {
+		window := unit.BandwidthWindow{}
+		if window.From, err = parseTimeOfDay(w.From); err != nil {
+			return policy, err
+		}
+		if window.To, err = parseTimeOfDay(w.To); err != nil {
+			return policy, err
+		}
+		if window.Limit, err = parseSize(w.Limit); err != nil {
+			return policy, err
+		}
+		policy.Schedule = append(policy.Schedule, window)
+	}
+	return policy, nil
+}
+
+var sizeUnits = []struct {
+	suffix string
+	size   int64
+}{
+	{"TB", 1 << 40}, {"T", 1 << 40},
+	{"GB", 1 << 30}, {"G", 1 << 30},
+	{"MB", 1 << 20}, {"M", 1 << 20},
+	{"KB", 1 << 10}, {"K", 1 << 10},
+	{"B", 1},
+}
+
+// parseSize converts "512KB", "10M", "1048576" to bytes. It is used for bandwidth (bytes per second) and quota of volumes
+func parseSize(v string) (int64, error) {
+	v = strings.ToUpper(strings.TrimSpace(v))
+	if v == "" {
+		return 0, nil
+	}
+
+	size := int64(1)
+	for _, u := range sizeUnits {
+		if strings.HasSuffix(v, u.suffix) {
+			v, size = strings.TrimSpace(strings.TrimSuffix(v, u.suffix)), u.size
+			break
+		}
+	}
+
+	n, err := strconv.ParseFloat(v, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("unexpected size '%s'", v)
+	}
+	return int64(n * float64(size)), nil
+}
+
+// parseAge converts "7d", "2w" or duration of Go ("36h") to duration
+func parseAge(v string) (time.Duration, error) {
+	v = strings.TrimSpace(v)
+	days := map[string]int{"d": 1, "w": 7}
+	for suffix, k := range days {
+		if n, ok := strings.CutSuffix(v, suffix); ok {
+			d, err := strconv.Atoi(n)
+			if err != nil || d < 0 {
+				return 0, fmt.Errorf("unexpected age '%s'", v)
+			}
+			return time.Duration(d*k) * 24 * time.Hour, nil
+		}
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil || d < 0 {
+		return 0, errors.Join(err, fmt.Errorf("unexpected age '%s'", v))
+	}
+	return d, nil
+}
+
+// parseTimeOfDay converts "18:30" to duration since midnight
+func parseTimeOfDay(v string) (time.Duration, error) {
+	t, err := time.Parse("15:04", strings.TrimSpace(v))
+	if err != nil {
+		return 0, errors.Join(err, fmt.Errorf("unexpected time of day '%s'", v))
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
+
 func joinErrors(errs []error, mainErr error) error {
 	if len(errs) == 0 {
 		return nil
@@ -2,6 +2,7 @@ package process
 
 import (
 	"bytes"
+	"fmt"
 	"runtime"
 	"strings"
 	"time"
@@ -16,6 +17,7 @@ import (
 	"github.com/vilasle/backilli/pkg/fs/executing"
 	"github.com/vilasle/backilli/pkg/fs/manager"
 	"github.com/vilasle/backilli/pkg/logger"
+	"github.com/vilasle/backilli/pkg/progress"
 )
 
 type Volume map[string]manager.ManagerAtomic
@@ -27,6 +29,8 @@ type Process struct {
 	entities     []entity.Entity
 	volumes      Volume
 	events       eventsManager
+	preflight    bool
+	scheduler    *entity.UploadScheduler
 }
 
 func (ps *Process) Entityes() []entity.Entity {
@@ -46,6 +50,16 @@ func InitProcess(conf cfg.ProcessConfig) (*Process, error) {
 	compress.Compressing = conf.Compressing()
 
 	process.catalogs = conf.Catalogs
+	process.preflight = conf.Preflight
+	process.scheduler = entity.NewUploadScheduler(conf.Uploads.MaxConcurrent, conf.Uploads.MaxPerVolume)
+
+	if conf.ProgressInterval != "" {
+		d, err := time.ParseDuration(conf.ProgressInterval)
+		if err != nil {
+			return nil, errors.Join(err, fmt.Errorf("unexpected interval of progress '%s'", conf.ProgressInterval))
+		}
+		progress.SetInterval(d)
+	}
 
 	logger.Debug("preparing config for initialize volumes")
 	configs, err := convertConfigForFSManagers(conf.Volumes)
@@ -89,7 +103,13 @@ func (ps *Process) Execute() error {
 	defer ps.beforeFinish()
 
 	ps.t = time.Now()
-	s := entity.EntitySetting{Tempdir: ps.catalogs.Transitory}
+	s := entity.EntitySetting{Tempdir: ps.catalogs.Transitory, Scheduler: ps.scheduler}
+
+	unhealthy := make(map[string]error)
+	if ps.preflight {
+		unhealthy = ps.preflightCheck()
+	}
+	s.Unhealthy = unhealthy
 
 	for _, ent := range ps.entities {
 		logger.Info("checking period rules", "task", ent)
@@ -98,6 +118,12 @@ func (ps *Process) Execute() error {
 			continue
 		}
 
+		if err := unhealthyVolumes(ent, unhealthy); err != nil {
+			logger.Error("task uses unhealthy volumes and will be skip", "task", ent, "error", err)
+			ent.Skip(err)
+			continue
+		}
+
 		st := time.Now()
 		logger.Info("run backup", "task", ent)
 		if ent.Backup(s, ps.t); ent.Err() != nil {
@@ -113,6 +139,46 @@ func (ps *Process) Execute() error {
 	return ps.Close()
 }
 
+// preflightCheck returns errors of volumes which did not pass the check
+func (ps *Process) preflightCheck() map[string]error {
+	logger.Info("checking volumes")
+	res := make(map[string]error)
+	for _, c := range ps.CheckVolumes() {
+		if c.Healthy() {
+			logger.Info("volume is healthy", "volume", c.Id, "latency", c.Latency.String())
+		} else {
+			logger.Error("volume is unhealthy", "volume", c.Id, "latency", c.Latency.String(), "error", c.Err)
+			res[c.Id] = c.Err
+		}
+	}
+	return res
+}
+
+// unhealthyVolumes returns error if write policy of entity can not be satisfied without unhealthy volumes.
+// Entity does not write backup to unhealthy volumes, they are failed volumes of backup in stat
+func unhealthyVolumes(ent entity.Entity, unhealthy map[string]error) error {
+	info, ok := ent.(entity.EntityInfo)
+	if !ok || len(unhealthy) == 0 {
+		return nil
+	}
+
+	errs := make([]error, 0)
+	for _, m := range info.FileManagers() {
+		if err, ok := unhealthy[manager.VolumeId(m)]; ok {
+			errs = append(errs, err)
+		}
+	}
+
+	// backup is written to healthy volumes if it is enough for write policy
+	total := len(info.FileManagers())
+	if len(errs) > 0 && info.WritePolicy().Enough(total-len(errs), total) {
+		logger.Warn("task uses unhealthy volumes, backup is written to healthy volumes only",
+			"task", info.Id(), "policy", info.WritePolicy().String(), "error", errors.Join(errs...))
+		return nil
+	}
+	return errors.Join(errs...)
+}
+
 func (mng eventsManager) BeforeStart() error {
 	var (
 		cmd, args []string
@@ -1,11 +1,27 @@
 package process
 
 import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
 	"testing"
+	"time"
 
+	"filippo.io/age"
 	cfg "github.com/vilasle/backilli/internal/config"
+	"github.com/vilasle/backilli/internal/entity"
+	"github.com/vilasle/backilli/internal/period"
+	"github.com/vilasle/backilli/internal/tool/encrypt"
 	env "github.com/vilasle/backilli/pkg/fs/environment"
+	"github.com/vilasle/backilli/pkg/fs/unit"
 	"github.com/vilasle/backilli/pkg/logger"
+	"github.com/vilasle/backilli/pkg/repository"
 )
 
 func TestNewProcessConfig(t *testing.T) {
@@ -36,3 +52,745 @@ func TestInitProcess(t *testing.T) {
 		t.Fatal(err)
 	}
 }
+
+func TestCheckVolumes(t *testing.T) {
+	logger.Init("local", io.Discard)
+
+	// root of volume can not be created because its parent is file
+	file := filepath.Join(t.TempDir(), "file")
+	if err := os.WriteFile(file, []byte("file"), os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+
+	healthyRoot := t.TempDir()
+	conf := cfg.ProcessConfig{
+		Volumes: []cfg.VolumeConfig{
+			{Id: "healthy", Type: cfg.LocalVolume, Root: healthyRoot},
+			{Id: "broken", Type: cfg.LocalVolume, Root: filepath.Join(file, "root")},
+		},
+	}
+
+	checks, err := CheckVolumes(conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(checks) != 2 {
+		t.Fatalf("expected 2 checks, there are %d", len(checks))
+	}
+
+	if checks[0].Id != "healthy" || !checks[0].Healthy() {
+		t.Fatalf("volume %s should be healthy, there is error %v", checks[0].Id, checks[0].Err)
+	}
+	if checks[1].Id != "broken" || checks[1].Healthy() {
+		t.Fatalf("volume %s should be unhealthy", checks[1].Id)
+	}
+
+	ls, err := os.ReadDir(healthyRoot)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ls) != 0 {
+		t.Fatalf("probe should be removed from volume, there is %v", ls)
+	}
+}
+
+func TestPreflightSkipsTasks(t *testing.T) {
+	logger.Init("local", io.Discard)
+
+	file := filepath.Join(t.TempDir(), "file")
+	if err := os.WriteFile(file, []byte("file"), os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+
+	src := t.TempDir()
+	if err := os.WriteFile(filepath.Join(src, "data.txt"), []byte("data"), os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+
+	conf := cfg.ProcessConfig{
+		Catalogs:  cfg.Catalogs{Transitory: t.TempDir()},
+		Preflight: true,
+		Volumes: []cfg.VolumeConfig{
+			{Id: "broken", Type: cfg.LocalVolume, Root: filepath.Join(file, "root")},
+		},
+		Tasks: []cfg.Task{
+			{
+				Id:      "files",
+				Type:    period.DAILY,
+				Repeat:  []int{period.Mon, period.Tue, period.Wed, period.Thu, period.Fri, period.Sat, period.Sun},
+				Files:   []cfg.FileConfig{{Path: src}},
+				Volumes: []string{"broken"},
+			},
+		},
+	}
+
+	proc, err := InitProcess(conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := proc.Execute(); err != nil {
+		t.Fatal(err)
+	}
+
+	es := proc.Stat().Entities()
+	if len(es) != 1 {
+		t.Fatalf("expected 1 entity in stat, there are %d", len(es))
+	}
+	if es[0].Status() != "skipped" || es[0].Err() == nil {
+		t.Fatalf("task with unhealthy volume should be skipped, there is status %s", es[0].Status())
+	}
+}
+
+func TestConvertBandwidthPolicy(t *testing.T) {
+	policy, err := convertBandwidthPolicy("10MB", []cfg.BandwidthWindow{
+		{From: "18:00", To: "02:30", Limit: "512K"},
+		{From: "12:00", To: "13:00", Limit: "1.5 KB"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if policy.Limit != 10<<20 {
+		t.Fatalf("unexpected limit %d", policy.Limit)
+	}
+	if len(policy.Schedule) != 2 {
+		t.Fatalf("unexpected schedule %v", policy.Schedule)
+	}
+	night := policy.Schedule[0]
+	if night.From != 18*time.Hour || night.To != 2*time.Hour+30*time.Minute || night.Limit != 512<<10 {
+		t.Fatalf("unexpected window %v", night)
+	}
+	if policy.Schedule[1].Limit != 1536 {
+		t.Fatalf("unexpected limit of window %d", policy.Schedule[1].Limit)
+	}
+
+	if _, err := convertBandwidthPolicy("fast", nil); err == nil {
+		t.Fatal("expected error of unexpected bandwidth")
+	}
+	if _, err := convertBandwidthPolicy("", []cfg.BandwidthWindow{{From: "25:00", To: "01:00"}}); err == nil {
+		t.Fatal("expected error of unexpected time of day")
+	}
+}
+
+// fakeCompressor creates script which archives directory as 7z does it ("a -tzip -v512m -mx5 dst src")
+func fakeCompressor(t *testing.T) string {
+	if runtime.GOOS == "windows" {
+		t.Skip("fake compressor is shell script")
+	}
+
+	path := filepath.Join(t.TempDir(), "7z")
+	script := "#!/bin/sh\ntar -cf \"$5\" -C \"$6\" .\n"
+	if err := os.WriteFile(path, []byte(script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestExecuteOnMemoryVolumes(t *testing.T) {
+	logger.Init("local", io.Discard)
+
+	src := filepath.Join(t.TempDir(), "src")
+	if err := os.MkdirAll(filepath.Join(src, "nested"), os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	for name, content := range map[string]string{"data.txt": "data", filepath.Join("nested", "more.txt"): "more data"} {
+		if err := os.WriteFile(filepath.Join(src, name), []byte(content), os.ModePerm); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	conf := cfg.ProcessConfig{
+		Catalogs: cfg.Catalogs{Transitory: t.TempDir()},
+		Volumes: []cfg.VolumeConfig{
+			{Id: "primary", Type: cfg.MemoryVolume, Root: "backups"},
+			{Id: "secondary", Type: cfg.MemoryVolume},
+		},
+		Tasks: []cfg.Task{
+			{
+				Id:         "files",
+				Type:       period.DAILY,
+				Repeat:     []int{period.Mon, period.Tue, period.Wed, period.Thu, period.Fri, period.Sat, period.Sun},
+				Files:      []cfg.FileConfig{{Path: src}},
+				Compress:   true,
+				Volumes:    []string{"primary", "secondary"},
+				KeepCopies: 1,
+			},
+		},
+	}
+	conf.ExternalTools.Compressing.Zip = fakeCompressor(t)
+
+	proc, err := InitProcess(conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// copy of previous run which has to be removed
+	old := []byte("old copy")
+	if _, err := proc.volumes["primary"].Write(bytes.NewReader(old), "files/01-01-2020/src/src.zip", unit.WriteOptions{}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := proc.Execute(); err != nil {
+		t.Fatal(err)
+	}
+
+	es := proc.Stat().Entities()
+	if len(es) != 1 {
+		t.Fatalf("expected 1 entity in stat, there are %d", len(es))
+	}
+	if es[0].Status() != "success" || es[0].Err() != nil {
+		t.Fatalf("unexpected result of task, status %s, error %v", es[0].Status(), es[0].Err())
+	}
+
+	uploads := es[0].Uploads()
+	if len(uploads) != 2 {
+		t.Fatalf("expected uploads to 2 volumes, there are %v", uploads)
+	}
+	for _, u := range uploads {
+		if u.Err != nil || !u.Verified {
+			t.Fatalf("upload to %s is failed or not verified: %v", u.Volume, u.Err)
+		}
+		content, err := proc.volumes[u.Volume].Read(u.Path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if fmt.Sprintf("%x", sha256.Sum256(content)) != u.SHA256 {
+			t.Fatalf("content of %s on %s does not match with checksum", u.Path, u.Volume)
+		}
+	}
+
+	ls, err := proc.volumes["primary"].Ls("files")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ls) != 1 || ls[0].Name != proc.t.Format("02-01-2006") {
+		t.Fatalf("expected the only copy of today, there are %v", ls)
+	}
+}
+
+func TestExecuteWithoutFreeSpace(t *testing.T) {
+	logger.Init("local", io.Discard)
+
+	src := filepath.Join(t.TempDir(), "src")
+	if err := os.MkdirAll(src, os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(src, "data.txt"), bytes.Repeat([]byte("data"), 1024), os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+
+	conf := cfg.ProcessConfig{
+		Catalogs: cfg.Catalogs{Transitory: t.TempDir()},
+		Volumes: []cfg.VolumeConfig{
+			{Id: "small", Type: cfg.MemoryVolume, Quota: "1KB"},
+		},
+		Tasks: []cfg.Task{
+			{
+				Id:       "files",
+				Type:     period.DAILY,
+				Repeat:   []int{period.Mon, period.Tue, period.Wed, period.Thu, period.Fri, period.Sat, period.Sun},
+				Files:    []cfg.FileConfig{{Path: src}},
+				Compress: true,
+				Volumes:  []string{"small"},
+			},
+		},
+	}
+
+	proc, err := InitProcess(conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := proc.Execute(); err != nil {
+		t.Fatal(err)
+	}
+
+	es := proc.Stat().Entities()
+	if len(es) != 1 || !errors.Is(es[0].Err(), entity.ErrNoSpace) {
+		t.Fatalf("expected error of free space, there is %v", es[0].Err())
+	}
+	if len(es[0].Uploads()) != 0 {
+		t.Fatalf("nothing should be uploaded, there are %v", es[0].Uploads())
+	}
+}
+
+func TestExecuteWithoutFreeSpaceOnVolume(t *testing.T) {
+	logger.Init("local", io.Discard)
+
+	src := filepath.Join(t.TempDir(), "src")
+	if err := os.MkdirAll(src, os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(src, "data.txt"), bytes.Repeat([]byte("data"), 1024), os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+
+	conf := cfg.ProcessConfig{
+		Catalogs: cfg.Catalogs{Transitory: t.TempDir()},
+		Volumes: []cfg.VolumeConfig{
+			{Id: "small", Type: cfg.MemoryVolume, Quota: "1KB"},
+			{Id: "primary", Type: cfg.MemoryVolume},
+			{Id: "secondary", Type: cfg.MemoryVolume},
+		},
+		Tasks: []cfg.Task{
+			{
+				Id:       "files",
+				Type:     period.DAILY,
+				Repeat:   []int{period.Mon, period.Tue, period.Wed, period.Thu, period.Fri, period.Sat, period.Sun},
+				Files:    []cfg.FileConfig{{Path: src}},
+				Compress: true,
+				Volumes:  []string{"small", "primary", "secondary"},
+			},
+		},
+	}
+	conf.ExternalTools.Compressing.Zip = fakeCompressor(t)
+
+	// volume without space is failed target of policy, the next volumes receive backup
+	for policy, written := range map[string][]string{
+		"first-available": {"primary"},
+		"quorum 2":        {"primary", "secondary"},
+	} {
+		conf.Tasks[0].WritePolicy = policy
+		proc, err := InitProcess(conf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := proc.Execute(); err != nil {
+			t.Fatal(err)
+		}
+
+		es := proc.Stat().Entities()
+		if len(es) != 1 || es[0].Status() != "degraded" || es[0].Err() != nil {
+			t.Fatalf("backup of policy '%s' should be degraded, there is status %s, error %v", policy, es[0].Status(), es[0].Err())
+		}
+		res := make([]string, 0)
+		for _, r := range entity.VolumeResults(es[0]) {
+			if r.Written {
+				res = append(res, r.Volume)
+			}
+			if r.Volume == "small" && (r.Written || !errors.Is(r.Err, entity.ErrNoSpace)) {
+				t.Fatalf("expected error of free space on volume small, there is %+v", r)
+			}
+		}
+		if strings.Join(res, ",") != strings.Join(written, ",") {
+			t.Fatalf("expected backup on %v by policy '%s', there is %v", written, policy, res)
+		}
+	}
+
+	// policy can not be satisfied without volume
+	conf.Tasks[0].WritePolicy = "quorum 3"
+	proc, err := InitProcess(conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := proc.Execute(); err != nil {
+		t.Fatal(err)
+	}
+	es := proc.Stat().Entities()
+	if len(es) != 1 || !errors.Is(es[0].Err(), entity.ErrNoSpace) || len(es[0].Uploads()) != 0 {
+		t.Fatalf("expected error of free space before writing, there is %v, uploads %v", es[0].Err(), es[0].Uploads())
+	}
+}
+
+func TestExecuteWithEncryption(t *testing.T) {
+	logger.Init("local", io.Discard)
+
+	src := filepath.Join(t.TempDir(), "src")
+	if err := os.MkdirAll(src, os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(src, "data.txt"), []byte("secret data"), os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+
+	id, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	identityFile := filepath.Join(t.TempDir(), "key.txt")
+	if err := os.WriteFile(identityFile, []byte(id.String()+"\n"), os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+
+	conf := cfg.ProcessConfig{
+		Catalogs: cfg.Catalogs{Transitory: t.TempDir()},
+		Volumes: []cfg.VolumeConfig{
+			{Id: "primary", Type: cfg.MemoryVolume},
+		},
+		Tasks: []cfg.Task{
+			{
+				Id:         "files",
+				Type:       period.DAILY,
+				Repeat:     []int{period.Mon, period.Tue, period.Wed, period.Thu, period.Fri, period.Sat, period.Sun},
+				Files:      []cfg.FileConfig{{Path: src}},
+				Compress:   true,
+				Volumes:    []string{"primary"},
+				KeepCopies: 1,
+				Encryption: cfg.Encryption{Recipients: []string{id.Recipient().String()}},
+			},
+		},
+	}
+	conf.ExternalTools.Compressing.Zip = fakeCompressor(t)
+
+	proc, err := InitProcess(conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := proc.Execute(); err != nil {
+		t.Fatal(err)
+	}
+
+	es := proc.Stat().Entities()
+	if len(es) != 1 || es[0].Err() != nil {
+		t.Fatalf("unexpected result of task %v", es)
+	}
+	if !strings.HasPrefix(es[0].KeyFingerprint(), "SHA256:") {
+		t.Fatalf("expected fingerprint of key, there is %q", es[0].KeyFingerprint())
+	}
+
+	uploads := es[0].Uploads()
+	if len(uploads) != 1 || uploads[0].Err != nil || !strings.HasSuffix(uploads[0].Path, encrypt.Extension) {
+		t.Fatalf("expected encrypted upload, there are %v", uploads)
+	}
+
+	content, err := proc.volumes["primary"].Read(uploads[0].Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(content, []byte("secret data")) {
+		t.Fatal("uploaded backup is not encrypted")
+	}
+
+	// backup which is downloaded from volume is decrypted to archive of dump
+	encrypted := filepath.Join(t.TempDir(), "backup.zip.age")
+	if err := os.WriteFile(encrypted, content, os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	var out bytes.Buffer
+	if err := Decrypt(conf, "", encrypted, identityFile, &out); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Contains(out.Bytes(), []byte("secret data")) {
+		t.Fatal("decrypted backup does not contain source data")
+	}
+}
+
+func TestExecuteWithRepository(t *testing.T) {
+	logger.Init("local", io.Discard)
+
+	src := filepath.Join(t.TempDir(), "src")
+	if err := os.MkdirAll(src, os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(src, "data.txt"), []byte("data"), os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+
+	conf := cfg.ProcessConfig{
+		Catalogs: cfg.Catalogs{Transitory: t.TempDir()},
+		Volumes: []cfg.VolumeConfig{
+			{Id: "primary", Type: cfg.MemoryVolume},
+		},
+		Tasks: []cfg.Task{
+			{
+				Id:         "files",
+				Type:       period.DAILY,
+				Repeat:     []int{period.Mon, period.Tue, period.Wed, period.Thu, period.Fri, period.Sat, period.Sun},
+				Files:      []cfg.FileConfig{{Path: src}},
+				Compress:   true,
+				Volumes:    []string{"primary"},
+				KeepCopies: 1,
+				Repository: true,
+			},
+		},
+	}
+	conf.ExternalTools.Compressing.Zip = fakeCompressor(t)
+
+	proc, err := InitProcess(conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := proc.Execute(); err != nil {
+		t.Fatal(err)
+	}
+
+	es := proc.Stat().Entities()
+	if len(es) != 1 || es[0].Err() != nil {
+		t.Fatalf("unexpected result of task %v", es[0].Err())
+	}
+	uploads := es[0].Uploads()
+	if len(uploads) != 1 || uploads[0].Err != nil || !strings.Contains(uploads[0].Path, "repository/snapshots/files/src/") {
+		t.Fatalf("expected snapshot in repository, there are %v", uploads)
+	}
+
+	repo, err := repository.New(proc.volumes["primary"], repository.DefaultParams)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ls, err := repo.Snapshots("files", "src")
+	if err != nil || len(ls) != 1 || len(ls[0].Files) != 1 || ls[0].Files[0].SHA256 != uploads[0].SHA256 {
+		t.Fatalf("unexpected snapshots %v, %v", ls, err)
+	}
+
+	conf.Tasks[0].Encryption = cfg.Encryption{Recipients: []string{"age1"}}
+	if _, err := InitProcess(conf); err == nil {
+		t.Fatal("expected error of encryption in repository")
+	}
+}
+
+func TestExecuteWithRetentionPerVolume(t *testing.T) {
+	logger.Init("local", io.Discard)
+
+	src := filepath.Join(t.TempDir(), "src")
+	if err := os.MkdirAll(src, os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(src, "data.txt"), []byte("data"), os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+
+	keep := 2
+	conf := cfg.ProcessConfig{
+		Catalogs: cfg.Catalogs{Transitory: t.TempDir()},
+		Volumes: []cfg.VolumeConfig{
+			{Id: "fast", Type: cfg.MemoryVolume},
+			{Id: "cold", Type: cfg.MemoryVolume},
+		},
+		Tasks: []cfg.Task{
+			{
+				Id:         "files",
+				Type:       period.DAILY,
+				Repeat:     []int{period.Mon, period.Tue, period.Wed, period.Thu, period.Fri, period.Sat, period.Sun},
+				Files:      []cfg.FileConfig{{Path: src}},
+				Compress:   true,
+				Volumes:    []string{"fast", "cold"},
+				KeepCopies: 1,
+				Retention:  map[string]cfg.VolumeRetention{"cold": {KeepCopies: &keep}},
+			},
+		},
+	}
+	conf.ExternalTools.Compressing.Zip = fakeCompressor(t)
+
+	proc, err := InitProcess(conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, id := range []string{"fast", "cold"} {
+		if _, err := proc.volumes[id].Write(bytes.NewReader([]byte("old copy")), "files/01-01-2020/src/src.zip", unit.WriteOptions{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := proc.Execute(); err != nil {
+		t.Fatal(err)
+	}
+
+	for id, copies := range map[string]int{"fast": 1, "cold": 2} {
+		ls, err := proc.volumes[id].Ls("files")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(ls) != copies {
+			t.Fatalf("expected %d copies on volume %s, there are %v", copies, id, ls)
+		}
+	}
+
+	conf.Tasks[0].Retention = map[string]cfg.VolumeRetention{"unknown": {KeepCopies: &keep}}
+	if _, err := InitProcess(conf); err == nil {
+		t.Fatal("expected error of retention of volume which is not used by task")
+	}
+}
+
+func TestExecuteWithWritePolicy(t *testing.T) {
+	logger.Init("local", io.Discard)
+
+	file := filepath.Join(t.TempDir(), "file")
+	if err := os.WriteFile(file, []byte("file"), os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	src := filepath.Join(t.TempDir(), "src")
+	if err := os.MkdirAll(src, os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(src, "data.txt"), []byte("data"), os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+
+	conf := cfg.ProcessConfig{
+		Catalogs:  cfg.Catalogs{Transitory: t.TempDir()},
+		Preflight: true,
+		Volumes: []cfg.VolumeConfig{
+			{Id: "broken", Type: cfg.LocalVolume, Root: filepath.Join(file, "root")},
+			{Id: "primary", Type: cfg.MemoryVolume},
+			{Id: "secondary", Type: cfg.MemoryVolume},
+		},
+		Tasks: []cfg.Task{
+			{
+				Id:          "files",
+				Type:        period.DAILY,
+				Repeat:      []int{period.Mon, period.Tue, period.Wed, period.Thu, period.Fri, period.Sat, period.Sun},
+				Files:       []cfg.FileConfig{{Path: src}},
+				Compress:    true,
+				Volumes:     []string{"broken", "primary", "secondary"},
+				KeepCopies:  1,
+				WritePolicy: "quorum 2",
+			},
+		},
+	}
+	conf.ExternalTools.Compressing.Zip = fakeCompressor(t)
+
+	proc, err := InitProcess(conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := proc.Execute(); err != nil {
+		t.Fatal(err)
+	}
+
+	es := proc.Stat().Entities()
+	if len(es) != 1 || es[0].Status() != "degraded" || es[0].Err() != nil {
+		t.Fatalf("backup which satisfies quorum should be degraded, there is status %s, error %v", es[0].Status(), es[0].Err())
+	}
+	for _, r := range entity.VolumeResults(es[0]) {
+		if r.Written != (r.Volume != "broken") {
+			t.Fatalf("unexpected result of volume %+v", r)
+		}
+	}
+	// unhealthy volume is not used by backup
+	for _, u := range es[0].Uploads() {
+		if u.Volume == "broken" && (u.File != "" || u.Err == nil) {
+			t.Fatalf("backup was written to unhealthy volume %+v", u)
+		}
+	}
+
+	conf.Tasks[0].WritePolicy = "quorum 4"
+	if _, err := InitProcess(conf); err == nil {
+		t.Fatal("expected error of quorum which is more than count of volumes")
+	}
+}
+
+func TestReplicateWithWritePolicy(t *testing.T) {
+	logger.Init("local", io.Discard)
+
+	roots := map[string]string{"primary": t.TempDir(), "secondary": t.TempDir(), "offsite": t.TempDir()}
+	conf := cfg.ProcessConfig{
+		Catalogs: cfg.Catalogs{Transitory: t.TempDir()},
+		Volumes: []cfg.VolumeConfig{
+			{Id: "primary", Type: cfg.LocalVolume, Root: roots["primary"]},
+			{Id: "secondary", Type: cfg.LocalVolume, Root: roots["secondary"]},
+			{Id: "offsite", Type: cfg.LocalVolume, Root: roots["offsite"]},
+		},
+		Tasks: []cfg.Task{
+			{
+				Id:          "files",
+				Type:        period.DAILY,
+				Repeat:      []int{period.Mon, period.Tue, period.Wed, period.Thu, period.Fri, period.Sat, period.Sun},
+				Files:       []cfg.FileConfig{{Path: "/data/src"}},
+				Volumes:     []string{"primary", "secondary"},
+				WritePolicy: "quorum 2",
+			},
+		},
+	}
+	p := filepath.Join("files", "01-01-2024", "src", "src.zip")
+	if err := os.MkdirAll(filepath.Join(roots["primary"], filepath.Dir(p)), os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(roots["primary"], p), []byte("copy"), os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+
+	replicas, err := Replicate(conf, "files", "primary", "offsite")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(replicas) != 1 || replicas[0].Err != nil {
+		t.Fatalf("expected copying of %s, there are %v", p, replicas)
+	}
+	if content, err := os.ReadFile(filepath.Join(roots["offsite"], p)); err != nil || string(content) != "copy" {
+		t.Fatalf("copy is not replicated: %q, %v", content, err)
+	}
+}
+
+func TestExecuteWithTiering(t *testing.T) {
+	logger.Init("local", io.Discard)
+
+	src := filepath.Join(t.TempDir(), "src")
+	if err := os.MkdirAll(src, os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(src, "data.txt"), []byte("data"), os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+
+	conf := cfg.ProcessConfig{
+		Catalogs: cfg.Catalogs{Transitory: t.TempDir()},
+		Volumes: []cfg.VolumeConfig{
+			{Id: "nas", Type: cfg.MemoryVolume},
+			{Id: "cloud", Type: cfg.MemoryVolume},
+		},
+		Tasks: []cfg.Task{
+			{
+				Id:         "files",
+				Type:       period.DAILY,
+				Repeat:     []int{period.Mon, period.Tue, period.Wed, period.Thu, period.Fri, period.Sat, period.Sun},
+				Files:      []cfg.FileConfig{{Path: src}},
+				Compress:   true,
+				Volumes:    []string{"nas"},
+				KeepCopies: 10,
+				Tiering:    cfg.Tiering{After: "7d", MoveTo: "cloud"},
+			},
+		},
+	}
+	conf.ExternalTools.Compressing.Zip = fakeCompressor(t)
+
+	proc, err := InitProcess(conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	old := "files/01-01-2020/src/src.zip"
+	if _, err := proc.volumes["nas"].Write(bytes.NewReader([]byte("old copy")), old, unit.WriteOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := proc.Execute(); err != nil {
+		t.Fatal(err)
+	}
+
+	es := proc.Stat().Entities()
+	if len(es) != 1 || es[0].Err() != nil {
+		t.Fatalf("unexpected result of task %v", es[0].Err())
+	}
+	if content, err := proc.volumes["cloud"].Read(old); err != nil || string(content) != "old copy" {
+		t.Fatalf("matured copy is not moved to colder volume: %q, %v", content, err)
+	}
+	ls, err := proc.volumes["nas"].Ls("files")
+	if err != nil || len(ls) != 1 || ls[0].Name != proc.t.Format("02-01-2006") {
+		t.Fatalf("expected the only copy of today on hot volume, there are %v, %v", ls, err)
+	}
+
+	conf.Tasks[0].Tiering.MoveTo = "unknown"
+	if _, err := InitProcess(conf); err == nil {
+		t.Fatal("expected error of undefined colder volume")
+	}
+	conf.Tasks[0].Tiering = cfg.Tiering{After: "7d", MoveTo: "cloud"}
+	conf.Tasks[0].Repository = true
+	if _, err := InitProcess(conf); err == nil {
+		t.Fatal("expected error of tiering in repository")
+	}
+}
+
+func TestParseAge(t *testing.T) {
+	for v, expected := range map[string]time.Duration{
+		"7d":  7 * 24 * time.Hour,
+		"2w":  14 * 24 * time.Hour,
+		"36h": 36 * time.Hour,
+	} {
+		if d, err := parseAge(v); err != nil || d != expected {
+			t.Fatalf("unexpected age of '%s': %v, %v", v, d, err)
+		}
+	}
+	for _, v := range []string{"", "week", "-1d", "1.5d"} {
+		if _, err := parseAge(v); err == nil {
+			t.Fatalf("expected error of age '%s'", v)
+		}
+	}
+}
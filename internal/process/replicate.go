@@ -0,0 +1,98 @@
+package process
+
+import (
+	"errors"
+	"fmt"
+
+	cfg "github.com/vilasle/backilli/internal/config"
+	"github.com/vilasle/backilli/internal/database"
+	"github.com/vilasle/backilli/internal/entity"
+	"github.com/vilasle/backilli/pkg/fs/manager"
+	"github.com/vilasle/backilli/pkg/logger"
+)
+
+// Replicate copies existing backups of task from one volume to other without dumping.
+// Only volumes of replication are connected. Backups which are on target already are skipped
+func Replicate(conf cfg.ProcessConfig, taskId, fromId, toId string) ([]entity.Replica, error) {
+	if err := conf.SetEnvironment(); err != nil {
+		return nil, errors.Join(err, errors.New("could not set environment vars"))
+	}
+
+	var task *cfg.Task
+	for i := range conf.Tasks {
+		if conf.Tasks[i].Id == taskId {
+			task = &conf.Tasks[i]
+		}
+	}
+	if task == nil {
+		return nil, fmt.Errorf("task %s is not defined", taskId)
+	}
+
+	from, err := connectVolume(conf, fromId)
+	if err != nil {
+		return nil, err
+	}
+	defer from.Close()
+	to, err := connectVolume(conf, toId)
+	if err != nil {
+		return nil, err
+	}
+	defer to.Close()
+
+	dbms := make(database.Managers)
+	if len(conf.DatabaseManagers) > 0 {
+		if dbms, err = database.InitManagersFromConfig(conf.DatabaseManagers); err != nil {
+			return nil, errors.Join(err, errors.New("could not init database managers"))
+		}
+	}
+
+	rule, err := periodRule(*task)
+	if err != nil {
+		return nil, err
+	}
+	// entities read backups from one volume, so write policy of task for its volumes is not applied
+	replicated := *task
+	replicated.WritePolicy = ""
+	cs, err := cfg.CreateBuilderConfigFromTask(replicated, []manager.ManagerAtomic{from}, rule, dbms)
+	if err != nil {
+		return nil, errors.Join(err, fmt.Errorf("there are errors on creation config tasks"))
+	}
+	es, err := entity.CreateAllEntities(cs)
+	if err != nil {
+		return nil, errors.Join(err, fmt.Errorf("could not create backup entity from config %v", cs))
+	}
+
+	res := make([]entity.Replica, 0)
+	errs := make([]error, 0)
+	for _, e := range es {
+		info, ok := e.(entity.EntityInfo)
+		if !ok {
+			continue
+		}
+		logger.Info("replicating backups", "task", taskId, "object", info.OID(), "from", fromId, "to", toId)
+		rs, err := entity.Replicate(info, from, to)
+		if err != nil {
+			errs = append(errs, err)
+		}
+		res = append(res, rs...)
+	}
+	return res, errors.Join(errs...)
+}
+
+func connectVolume(conf cfg.ProcessConfig, id string) (manager.ManagerAtomic, error) {
+	configs, err := convertConfigForFSManagers(conf.Volumes)
+	if err != nil {
+		return nil, err
+	}
+	for _, c := range configs {
+		if c.Id != id {
+			continue
+		}
+		m, err := manager.NewManager(c)
+		if err != nil {
+			return nil, errors.Join(err, fmt.Errorf("could not connect to volume %s", c.Id))
+		}
+		return m, nil
+	}
+	return nil, fmt.Errorf("volume %s is not defined", id)
+}
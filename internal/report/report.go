@@ -3,37 +3,81 @@ package report
 import (
 	"time"
 
+	"github.com/vilasle/backilli/internal/entity"
 	ps "github.com/vilasle/backilli/internal/process"
 )
 
 type Reports []Report
 
 type Report struct {
-	Date       time.Time `json:"date"`
-	Name       string    `json:"id"`
-	OID        string    `json:"name"`
-	Status     string    `json:"status"`
-	StartTime  time.Time `json:"startTime"`
-	EndTime    time.Time `json:"finishTime"`
-	SourceSize int64     `json:"sourceSize"`
-	BackupSize int64     `json:"backupSize"`
-	Paths      []string  `json:"paths"`
-	Details    string    `json:"details"`
+	Date           time.Time `json:"date"`
+	Name           string    `json:"id"`
+	OID            string    `json:"name"`
+	Status         string    `json:"status"`
+	StartTime      time.Time `json:"startTime"`
+	EndTime        time.Time `json:"finishTime"`
+	SourceSize     int64     `json:"sourceSize"`
+	BackupSize     int64     `json:"backupSize"`
+	Paths          []string  `json:"paths"`
+	Uploads        []Upload  `json:"uploads"`
+	WritePolicy    string    `json:"writePolicy"`
+	Volumes        []Volume  `json:"volumes"`
+	KeyFingerprint string    `json:"keyFingerprint"`
+	Details        string    `json:"details"`
+}
+
+// Volume - result of writing backup to volume, status is "written", "failed" or "unused"
+// if volume was not needed by write policy
+type Volume struct {
+	Volume  string `json:"volume"`
+	Status  string `json:"status"`
+	Details string `json:"details"`
+}
+
+type Upload struct {
+	Volume   string `json:"volume"`
+	File     string `json:"file"`
+	Path     string `json:"path"`
+	Retries  int    `json:"retries"`
+	SHA256   string `json:"sha256"`
+	Verified bool   `json:"verified"`
+	Details  string `json:"details"`
 }
 
 func InitReports(stat *ps.ProcessStat) Reports {
 	rps := make(Reports, 0)
 	for _, e := range stat.Entities() {
 		r := Report{
-			Date:       stat.Date,
-			Name:       e.Id(),
-			OID:        e.OID(),
-			Status:     e.Status(),
-			StartTime:  e.StartTime(),
-			EndTime:    e.EndTime(),
-			SourceSize: e.EntitySize(),
-			BackupSize: e.BackupSize(),
-			Paths:      e.BackupPaths(),
+			Date:           stat.Date,
+			Name:           e.Id(),
+			OID:            e.OID(),
+			Status:         e.Status(),
+			StartTime:      e.StartTime(),
+			EndTime:        e.EndTime(),
+			SourceSize:     e.EntitySize(),
+			BackupSize:     e.BackupSize(),
+			Paths:          e.BackupPaths(),
+			Uploads:        make([]Upload, 0, len(e.Uploads())),
+			WritePolicy:    e.WritePolicy().String(),
+			Volumes:        make([]Volume, 0, len(e.FileManagers())),
+			KeyFingerprint: e.KeyFingerprint(),
+		}
+		for _, u := range e.Uploads() {
+			ur := Upload{
+				Volume:   u.Volume,
+				File:     u.File,
+				Path:     u.Path,
+				Retries:  u.Retries,
+				SHA256:   u.SHA256,
+				Verified: u.Verified,
+			}
+			if u.Err != nil {
+				ur.Details = u.Err.Error()
+			}
+			r.Uploads = append(r.Uploads, ur)
+		}
+		for _, v := range entity.VolumeResults(e) {
+			r.Volumes = append(r.Volumes, volumeReport(v))
 		}
 		if e.Err() != nil {
 			r.Details = e.Err().Error()
@@ -42,3 +86,17 @@ func InitReports(stat *ps.ProcessStat) Reports {
 	}
 	return rps
 }
+
+func volumeReport(v entity.VolumeResult) Volume {
+	vr := Volume{Volume: v.Volume, Status: "unused"}
+	switch {
+	case v.Written:
+		vr.Status = "written"
+	case v.Attempted:
+		vr.Status = "failed"
+	}
+	if v.Err != nil {
+		vr.Details = v.Err.Error()
+	}
+	return vr
+}
@@ -0,0 +1,155 @@
+package encrypt
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"filippo.io/age"
+)
+
+// Extension - suffix of encrypted file
+const Extension = ".age"
+
+// Encryptor encrypts backups for recipients of age (https://age-encryption.org).
+// Any of identities of recipients decrypts backup
+type Encryptor struct {
+	recipients  []age.Recipient
+	fingerprint string
+}
+
+// NewEncryptor accepts public keys of recipients ("age1...") and file with them (one per line, # is comment)
+func NewEncryptor(recipients []string, recipientsFile string) (*Encryptor, error) {
+	keys := make([]string, 0, len(recipients))
+	for _, r := range recipients {
+		if r = strings.TrimSpace(r); r != "" {
+			keys = append(keys, r)
+		}
+	}
+
+	if recipientsFile != "" {
+		fromFile, err := readKeys(recipientsFile)
+		if err != nil {
+			return nil, errors.Join(err, fmt.Errorf("could not read recipients from %s", recipientsFile))
+		}
+		keys = append(keys, fromFile...)
+	}
+
+	if len(keys) == 0 {
+		return nil, errors.New("recipients of encryption are not defined")
+	}
+
+	enc := &Encryptor{recipients: make([]age.Recipient, 0, len(keys))}
+	for _, k := range keys {
+		r, err := age.ParseX25519Recipient(k)
+		if err != nil {
+			return nil, errors.Join(err, fmt.Errorf("unexpected recipient %s", k))
+		}
+		enc.recipients = append(enc.recipients, r)
+	}
+	enc.fingerprint = fingerprint(keys)
+	return enc, nil
+}
+
+// Fingerprint identifies set of recipients, it is saved to report
+// so it is known which keys decrypt backup
+func (e *Encryptor) Fingerprint() string {
+	return e.fingerprint
+}
+
+// Encrypt writes encrypted content of src to dst
+func (e *Encryptor) Encrypt(dst io.Writer, src io.Reader) error {
+	w, err := age.Encrypt(dst, e.recipients...)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(w, src); err != nil {
+		return err
+	}
+	return w.Close()
+}
+
+// EncryptFile encrypts file to the same directory and removes source. It returns path of encrypted file
+func (e *Encryptor) EncryptFile(path string) (string, error) {
+	src, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer src.Close()
+
+	encrypted := path + Extension
+	dst, err := os.Create(encrypted)
+	if err != nil {
+		return "", err
+	}
+	defer dst.Close()
+
+	if err := e.Encrypt(dst, src); err != nil {
+		os.Remove(encrypted)
+		return "", errors.Join(err, fmt.Errorf("could not encrypt %s", path))
+	}
+	if err := dst.Close(); err != nil {
+		return "", err
+	}
+
+	src.Close()
+	return encrypted, os.Remove(path)
+}
+
+// LoadIdentities reads secret keys ("AGE-SECRET-KEY-1...") from file which is created by age-keygen
+func LoadIdentities(path string) ([]age.Identity, error) {
+	fd, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer fd.Close()
+
+	identities, err := age.ParseIdentities(fd)
+	if err != nil {
+		return nil, errors.Join(err, fmt.Errorf("could not parse identities from %s", path))
+	}
+	return identities, nil
+}
+
+// Decrypt writes decrypted content of src to dst
+func Decrypt(dst io.Writer, src io.Reader, identities ...age.Identity) error {
+	rd, err := age.Decrypt(src, identities...)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(dst, rd)
+	return err
+}
+
+func readKeys(path string) ([]string, error) {
+	fd, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer fd.Close()
+
+	keys := make([]string, 0)
+	scanner := bufio.NewScanner(fd)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		keys = append(keys, line)
+	}
+	return keys, scanner.Err()
+}
+
+// fingerprint does not depend on order of recipients
+func fingerprint(keys []string) string {
+	sorted := append([]string(nil), keys...)
+	sort.Strings(sorted)
+	sum := sha256.Sum256([]byte(strings.Join(sorted, "\n")))
+	return "SHA256:" + base64.RawStdEncoding.EncodeToString(sum[:])
+}
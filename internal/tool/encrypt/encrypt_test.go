@@ -0,0 +1,131 @@
+package encrypt
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"filippo.io/age"
+)
+
+func newIdentity(t *testing.T) *age.X25519Identity {
+	id, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return id
+}
+
+func TestEncryptFile(t *testing.T) {
+	first, second := newIdentity(t), newIdentity(t)
+
+	enc, err := NewEncryptor([]string{first.Recipient().String(), second.Recipient().String()}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(t.TempDir(), "backup.zip")
+	content := []byte("content of backup")
+	if err := os.WriteFile(path, content, os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+
+	encrypted, err := enc.EncryptFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if encrypted != path+Extension {
+		t.Fatalf("unexpected path of encrypted file %s", encrypted)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Fatalf("source file has to be removed, there is %v", err)
+	}
+
+	data, err := os.ReadFile(encrypted)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(data, content) {
+		t.Fatal("encrypted file contains source content")
+	}
+
+	// every recipient decrypts backup
+	for _, id := range []age.Identity{first, second} {
+		var out bytes.Buffer
+		if err := Decrypt(&out, bytes.NewReader(data), id); err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(out.Bytes(), content) {
+			t.Fatalf("expected %q after decrypting, there is %q", content, out.Bytes())
+		}
+	}
+
+	var out bytes.Buffer
+	if err := Decrypt(&out, bytes.NewReader(data), newIdentity(t)); err == nil {
+		t.Fatal("expected error of decrypting with foreign key")
+	}
+}
+
+func TestRecipientsFile(t *testing.T) {
+	first, second := newIdentity(t), newIdentity(t)
+
+	dir := t.TempDir()
+	recipients := filepath.Join(dir, "recipients.txt")
+	keys := "# backup keys\n" + second.Recipient().String() + "\n\n"
+	if err := os.WriteFile(recipients, []byte(keys), os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+
+	fromFile, err := NewEncryptor([]string{first.Recipient().String()}, recipients)
+	if err != nil {
+		t.Fatal(err)
+	}
+	inline, err := NewEncryptor([]string{second.Recipient().String(), first.Recipient().String()}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fromFile.Fingerprint() != inline.Fingerprint() {
+		t.Fatalf("fingerprint depends on order of keys: %s, %s", fromFile.Fingerprint(), inline.Fingerprint())
+	}
+
+	other, err := NewEncryptor([]string{first.Recipient().String()}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if other.Fingerprint() == inline.Fingerprint() {
+		t.Fatal("expected different fingerprint for different keys")
+	}
+
+	identities := filepath.Join(dir, "key.txt")
+	if err := os.WriteFile(identities, []byte("# created: now\n"+second.String()+"\n"), os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	ids, err := LoadIdentities(identities)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var encrypted, out bytes.Buffer
+	if err := fromFile.Encrypt(&encrypted, bytes.NewReader([]byte("data"))); err != nil {
+		t.Fatal(err)
+	}
+	if err := Decrypt(&out, &encrypted, ids...); err != nil {
+		t.Fatal(err)
+	}
+	if out.String() != "data" {
+		t.Fatalf("unexpected content after decrypting %q", out.String())
+	}
+}
+
+func TestUnexpectedRecipients(t *testing.T) {
+	if _, err := NewEncryptor(nil, ""); err == nil {
+		t.Fatal("expected error of not defined recipients")
+	}
+	if _, err := NewEncryptor([]string{"age1notakey"}, ""); err == nil {
+		t.Fatal("expected error of unexpected recipient")
+	}
+	if _, err := NewEncryptor(nil, filepath.Join(t.TempDir(), "missing.txt")); err == nil {
+		t.Fatal("expected error of missing file of recipients")
+	}
+}
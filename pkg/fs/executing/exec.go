@@ -7,12 +7,32 @@ import (
 	"syscall"
 )
 
+// ExitError - command was finished with non-zero code
+type ExitError struct {
+	Code int
+}
+
+func (e *ExitError) Error() string {
+	return fmt.Sprintf("exit Status: %d", e.Code)
+}
+
 func Execute(command string,
 	out io.Writer,
 	err io.Writer,
 	args ...string) error {
 
+	return ExecuteWithInput(command, nil, out, err, args...)
+}
+
+// ExecuteWithInput runs command which reads in from stdin
+func ExecuteWithInput(command string,
+	in io.Reader,
+	out io.Writer,
+	err io.Writer,
+	args ...string) error {
+
 	cmd := exec.Command(command, args...)
+	cmd.Stdin = in
 	cmd.Stderr = err
 	cmd.Stdout = out
 
@@ -27,7 +47,7 @@ func execCommand(cmd *exec.Cmd) (err error) {
 	if err := cmd.Wait(); err != nil {
 		if exiterr, ok := err.(*exec.ExitError); ok {
 			if status, ok := exiterr.Sys().(syscall.WaitStatus); ok {
-				return fmt.Errorf("exit Status: %d", status.ExitStatus())
+				return &ExitError{Code: status.ExitStatus()}
 			}
 		} else {
 			return fmt.Errorf("cmd.Wait: %v", err)
@@ -1,6 +1,7 @@
 package fs
 
 import (
+	iofs "io/fs"
 	"os"
 	"path/filepath"
 	"strings"
@@ -36,6 +37,40 @@ func CompressDir(dir string, destination string) (string, error) {
 	}
 }
 
+// DirSize returns size of files in directory and its subdirectories. Files which could not be read are skipped,
+// it is used for following of external tools
+func DirSize(path string) int64 {
+	var size int64
+	filepath.WalkDir(path, func(_ string, d iofs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if info, err := d.Info(); err == nil && !d.IsDir() {
+			size += info.Size()
+		}
+		return nil
+	})
+	return size
+}
+
+// PartsSize returns size of file and its parts with the same prefix (archive.zip.001, archive.zip.002)
+func PartsSize(path string) int64 {
+	ls, err := os.ReadDir(filepath.Dir(path))
+	if err != nil {
+		return 0
+	}
+	var size int64
+	for _, f := range ls {
+		if f.IsDir() || !strings.HasPrefix(f.Name(), filepath.Base(path)) {
+			continue
+		}
+		if info, err := f.Info(); err == nil {
+			size += info.Size()
+		}
+	}
+	return size
+}
+
 func GetFullPath(sep string, path ...string) string {
 	if sep == "" {
 		sep = string(filepath.Separator)
@@ -50,3 +85,24 @@ func Dir(path string) string {
 func Base(path string) string {
 	return filepath.Base(path)
 }
+
+// PartialSuffix - suffix of file which is being written. File gets final name when writing is finished
+const PartialSuffix = ".partial"
+
+// PartialName returns temporary name of file in the same directory
+func PartialName(path string) string {
+	return path + PartialSuffix
+}
+
+// IsPartial reports whether file was not written completely
+func IsPartial(name string) bool {
+	return strings.HasSuffix(name, PartialSuffix)
+}
+
+// InRoot reports whether path contains root of volume already, as path which is returned by Write of volume does.
+// Separators of path and root can be any
+func InRoot(root, path string) bool {
+	root = strings.TrimSuffix(strings.ReplaceAll(root, "\\", "/"), "/")
+	path = strings.ReplaceAll(path, "\\", "/")
+	return root != "" && (path == root || strings.HasPrefix(path, root+"/"))
+}
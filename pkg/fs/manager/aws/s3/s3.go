@@ -0,0 +1,422 @@
+package s3
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	iofs "io/fs"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	s3manager "github.com/aws/aws-sdk-go-v2/feature/s3/manager"
+	awss3 "github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/vilasle/backilli/pkg/fs"
+	"github.com/vilasle/backilli/pkg/fs/unit"
+)
+
+var ErrLoadingConfiguration = fmt.Errorf("failed to load cloud configuration")
+
+// DeleteObjects accepts no more than 1000 keys in one request
+const deleteBatchSize = 1000
+
+// PartSize - size of part for multipart uploading. Every concurrent part is buffered in memory
+var PartSize int64 = 16 * 1024 * 1024
+
+// S3Client works with any storage which is compatible with Amazon S3 API
+// (AWS, Yandex Object Storage, MinIO, Ceph RGW, Wasabi and etc.)
+type S3Client struct {
+	s3client   *awss3.Client
+	endpoint   string
+	region     string
+	bucketName string
+	cloudSep   string
+	id         string
+	cloudRoot  string
+	quota      int64
+	class      types.StorageClass
+	sse        types.ServerSideEncryption
+	kmsKeyId   string
+	lockMode   types.ObjectLockMode
+}
+
+// conf.Endpoint - URL of storage. If it is empty then will use endpoints of AWS
+// conf.PathStyle - use path-style addressing (https://host/bucket/key) instead of virtual hosted-style
+// conf.InsecureSkipVerify - does not verify TLS certificate of storage
+// conf.KeyId, conf.KeySecret - static credentials of client. Every client has own credentials,
+// so volumes can belong to different accounts. If they are empty then default chain of AWS is used
+// (environment, shared credentials, role of instance)
+// conf.Quota - limit of size of objects under root, buckets do not have limit of size themselves
+// conf.StorageClass - class of uploaded objects (STANDARD_IA, GLACIER, COLD and etc.). Classes depend on storage,
+// so they are passed as is
+// conf.SSE - server-side encryption of uploaded objects: AES256 or aws:kms with optional conf.SSEKMSKeyId
+// conf.ObjectLockMode - GOVERNANCE or COMPLIANCE. Objects are locked till WriteOptions.RetainUntil,
+// bucket has to be created with enabled object lock
+func NewClient(conf unit.ClientConfig) (*S3Client, error) {
+	sse := types.ServerSideEncryption(conf.SSE)
+	switch sse {
+	case "", types.ServerSideEncryptionAes256, types.ServerSideEncryptionAwsKms:
+	default:
+		return nil, fmt.Errorf("unexpected server-side encryption %s, expected %s or %s",
+			conf.SSE, types.ServerSideEncryptionAes256, types.ServerSideEncryptionAwsKms)
+	}
+	if conf.SSEKMSKeyId != "" && sse != types.ServerSideEncryptionAwsKms {
+		return nil, fmt.Errorf("key of KMS is used with server-side encryption %s only", types.ServerSideEncryptionAwsKms)
+	}
+
+	lockMode := types.ObjectLockMode(strings.ToUpper(conf.ObjectLockMode))
+	switch lockMode {
+	case "", types.ObjectLockModeGovernance, types.ObjectLockModeCompliance:
+	default:
+		return nil, fmt.Errorf("unexpected mode of object lock %s, expected %s or %s",
+			conf.ObjectLockMode, types.ObjectLockModeGovernance, types.ObjectLockModeCompliance)
+	}
+
+	opts := make([]func(*config.LoadOptions) error, 0, 4)
+	if conf.Region != "" {
+		opts = append(opts, config.WithRegion(conf.Region))
+	}
+
+	if conf.KeyId != "" || conf.KeySecret != "" {
+		provider := credentials.NewStaticCredentialsProvider(conf.KeyId, conf.KeySecret, "")
+		opts = append(opts, config.WithCredentialsProvider(provider))
+	}
+
+	if conf.Endpoint != "" {
+		resolver := endpointResolver(conf.Endpoint, conf.Region)
+		opts = append(opts, config.WithEndpointResolverWithOptions(resolver))
+	}
+
+	if conf.InsecureSkipVerify {
+		opts = append(opts, config.WithHTTPClient(insecureHTTPClient()))
+	}
+
+	cfg, err := config.LoadDefaultConfig(context.Background(), opts...)
+	if err != nil {
+		return nil, ErrLoadingConfiguration
+	}
+
+	s3client := awss3.NewFromConfig(cfg, func(o *awss3.Options) {
+		o.UsePathStyle = conf.PathStyle
+	})
+
+	return &S3Client{
+		s3client:   s3client,
+		endpoint:   conf.Endpoint,
+		region:     conf.Region,
+		id:         conf.Id,
+		cloudRoot:  conf.Root,
+		cloudSep:   "/",
+		bucketName: conf.BucketName,
+		quota:      conf.Quota,
+		class:      types.StorageClass(strings.ToUpper(conf.StorageClass)),
+		sse:        sse,
+		kmsKeyId:   conf.SSEKMSKeyId,
+		lockMode:   lockMode,
+	}, nil
+}
+
+// Read accepts path relative to root, key of object or path which was returned by Write (bucket/key)
+func (c S3Client) Read(path string) ([]byte, error) {
+	rc, err := c.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+
+	var buffer bytes.Buffer
+	if _, err := io.Copy(&buffer, rc); err != nil {
+		return nil, err
+	}
+	return buffer.Bytes(), nil
+}
+
+func (c S3Client) Open(path string) (io.ReadCloser, error) {
+	object := &awss3.GetObjectInput{
+		Bucket: aws.String(c.bucketName),
+		Key:    aws.String(c.objectKey(path)),
+	}
+	resp, err := c.s3client.GetObject(context.Background(), object)
+	if err != nil {
+		return nil, notExist(err, path)
+	}
+	return resp.Body, nil
+}
+
+func (c S3Client) Write(rd io.Reader, dst string, opt unit.WriteOptions) (string, error) {
+	return c.put(rd, dst, opt)
+}
+
+// put uploads content by parts if it is larger than PartSize, so content is never loaded into memory entirely
+func (c S3Client) put(rd io.Reader, dst string, opt unit.WriteOptions) (string, error) {
+	cloudPath := c.key(dst)
+	bckpath := fs.GetFullPath("/", c.bucketName, cloudPath)
+	object := &awss3.PutObjectInput{
+		Bucket: aws.String(c.bucketName),
+		Key:    aws.String(cloudPath),
+		Body:   rd,
+	}
+	c.setObjectOptions(object, opt)
+
+	uploader := s3manager.NewUploader(c.s3client, func(u *s3manager.Uploader) {
+		u.PartSize = partSize(opt.Size)
+	})
+
+	if _, err := uploader.Upload(context.Background(), object); err != nil {
+		return "", err
+	} else {
+		return bckpath, nil
+	}
+}
+
+// setObjectOptions applies storage class, encryption and lock of volume to uploaded object
+func (c S3Client) setObjectOptions(object *awss3.PutObjectInput, opt unit.WriteOptions) {
+	object.StorageClass = c.class
+	object.ServerSideEncryption = c.sse
+	if c.kmsKeyId != "" {
+		object.SSEKMSKeyId = aws.String(c.kmsKeyId)
+	}
+
+	if c.lockMode != "" && !opt.RetainUntil.IsZero() {
+		object.ObjectLockMode = c.lockMode
+		object.ObjectLockRetainUntilDate = aws.Time(opt.RetainUntil.UTC())
+		// storage requires checksum of content for locked objects
+		object.ChecksumAlgorithm = types.ChecksumAlgorithmSha256
+	}
+}
+
+// Verify checks size of object which was written by Write and its ETag if it is MD5 of content.
+// ETag of object which was uploaded by parts or encrypted by KMS is not MD5, so only size is checked for it
+func (c S3Client) Verify(dst string, sum unit.Checksum) error {
+	key := c.key(dst)
+	head, err := c.s3client.HeadObject(context.Background(), &awss3.HeadObjectInput{
+		Bucket: aws.String(c.bucketName),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return err
+	}
+
+	if head.ContentLength != sum.Size {
+		return fmt.Errorf("%w: expected %d bytes of object %s, there are %d bytes",
+			unit.ErrChecksumMismatch, sum.Size, key, head.ContentLength)
+	}
+
+	etag := strings.Trim(aws.ToString(head.ETag), `"`)
+	if etag != "" && c.sse != types.ServerSideEncryptionAwsKms &&
+		!strings.Contains(etag, "-") && !strings.EqualFold(etag, sum.MD5) {
+		return fmt.Errorf("%w: expected md5 %s of object %s, there is %s",
+			unit.ErrChecksumMismatch, sum.MD5, key, etag)
+	}
+	return nil
+}
+
+// Ls returns files and "directories" (common prefixes) which are placed directly under path.
+// Directories do not have date of modification in S3, so their dates are zero
+func (c S3Client) Ls(path string) ([]unit.File, error) {
+	prefix := c.prefix(path)
+	paginator := awss3.NewListObjectsV2Paginator(c.s3client, &awss3.ListObjectsV2Input{
+		Bucket:    aws.String(c.bucketName),
+		Prefix:    aws.String(prefix),
+		Delimiter: aws.String(c.cloudSep),
+	})
+
+	files := make([]unit.File, 0)
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(context.Background())
+		if err != nil {
+			return nil, err
+		}
+
+		for _, p := range page.CommonPrefixes {
+			name := strings.TrimSuffix(strings.TrimPrefix(aws.ToString(p.Prefix), prefix), c.cloudSep)
+			files = append(files, unit.NewFile(name, time.Time{}))
+		}
+
+		for _, object := range page.Contents {
+			name := strings.TrimPrefix(aws.ToString(object.Key), prefix)
+			// placeholder of directory which some clients create
+			if name == "" {
+				continue
+			}
+			files = append(files, unit.NewFile(name, aws.ToTime(object.LastModified)))
+		}
+	}
+	return files, nil
+}
+
+// FreeSpace returns difference between quota and size of objects under root
+func (c S3Client) FreeSpace() (int64, error) {
+	if c.quota <= 0 {
+		return 0, unit.ErrUnknownFreeSpace
+	}
+
+	paginator := awss3.NewListObjectsV2Paginator(c.s3client, &awss3.ListObjectsV2Input{
+		Bucket: aws.String(c.bucketName),
+		Prefix: aws.String(c.prefix("")),
+	})
+
+	var used int64
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(context.Background())
+		if err != nil {
+			return 0, err
+		}
+		for _, object := range page.Contents {
+			used += object.Size
+		}
+	}
+	return c.quota - used, nil
+}
+
+// Remove deletes object and all objects under it as under directory
+func (c S3Client) Remove(path string) error {
+	key := strings.TrimSuffix(c.key(path), c.cloudSep)
+
+	paginator := awss3.NewListObjectsV2Paginator(c.s3client, &awss3.ListObjectsV2Input{
+		Bucket:  aws.String(c.bucketName),
+		Prefix:  aws.String(c.prefix(path)),
+		MaxKeys: deleteBatchSize,
+	})
+
+	objects := []types.ObjectIdentifier{{Key: aws.String(key)}}
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(context.Background())
+		if err != nil {
+			return err
+		}
+
+		for _, object := range page.Contents {
+			objects = append(objects, types.ObjectIdentifier{Key: object.Key})
+			if len(objects) == deleteBatchSize {
+				if err := c.deleteObjects(objects); err != nil {
+					return err
+				}
+				objects = objects[:0]
+			}
+		}
+	}
+	return c.deleteObjects(objects)
+}
+
+func (c S3Client) deleteObjects(objects []types.ObjectIdentifier) error {
+	if len(objects) == 0 {
+		return nil
+	}
+
+	resp, err := c.s3client.DeleteObjects(context.Background(), &awss3.DeleteObjectsInput{
+		Bucket: aws.String(c.bucketName),
+		Delete: &types.Delete{
+			Objects: objects,
+			Quiet:   true,
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	errs := make([]error, 0, len(resp.Errors))
+	for _, e := range resp.Errors {
+		errs = append(errs, fmt.Errorf("could not delete object %s: %s %s",
+			aws.ToString(e.Key), aws.ToString(e.Code), aws.ToString(e.Message)))
+	}
+	return errors.Join(errs...)
+}
+
+// prefix returns prefix of objects which are placed under path as under directory
+func (c S3Client) prefix(path string) string {
+	prefix := c.key(path)
+	if prefix != "" && !strings.HasSuffix(prefix, c.cloudSep) {
+		prefix += c.cloudSep
+	}
+	return prefix
+}
+
+func (c S3Client) Close() error {
+	return nil
+}
+
+func (c S3Client) Description() map[string]any {
+	res := make(map[string]any)
+	res["name"] = "s3"
+	res["id"] = c.id
+	res["endpoint"] = c.endpoint
+	res["region"] = c.region
+	res["root"] = c.cloudRoot
+	res["bucket"] = c.bucketName
+
+	return res
+}
+
+// key returns key of object which contains root of client
+func (c S3Client) key(dst string) string {
+	cloudRoot := c.cloudRoot
+	if cloudRoot != "" && (cloudRoot[len(cloudRoot)-1] == 0x5c ||
+		cloudRoot[len(cloudRoot)-1] == 0x2f) {
+		cloudRoot = cloudRoot[:len(cloudRoot)-1]
+	}
+
+	s := bytes.ReplaceAll([]byte(dst), []byte{0x5c}, []byte{0x2f})
+
+	if cloudRoot == "" {
+		return strings.TrimPrefix(string(s), c.cloudSep)
+	}
+	return fmt.Sprintf("%s%s%s", cloudRoot, c.cloudSep, strings.TrimPrefix(string(s), c.cloudSep))
+}
+
+// objectKey returns key of object by path which is relative to root or contains root already (key, bucket/key)
+func (c S3Client) objectKey(path string) string {
+	key := strings.TrimPrefix(strings.ReplaceAll(path, "\\", c.cloudSep), c.bucketName+c.cloudSep)
+	root := strings.Trim(strings.ReplaceAll(c.cloudRoot, "\\", c.cloudSep), c.cloudSep)
+	if root != "" && strings.HasPrefix(key, root+c.cloudSep) {
+		return key
+	}
+	return c.key(key)
+}
+
+// partSize increases size of part if content is too large for uploading by PartSize
+func partSize(size int64) int64 {
+	if size/int64(s3manager.MaxUploadParts) >= PartSize {
+		return size/int64(s3manager.MaxUploadParts) + 1
+	}
+	return PartSize
+}
+
+func endpointResolver(endpoint string, region string) aws.EndpointResolverWithOptionsFunc {
+	return func(service string, _ string, options ...interface{}) (aws.Endpoint, error) {
+		if service == awss3.ServiceID {
+			return aws.Endpoint{
+				URL:           endpoint,
+				SigningRegion: region,
+				Source:        aws.EndpointSourceCustom,
+			}, nil
+		}
+		return aws.Endpoint{}, fmt.Errorf("unknown endpoint requested")
+	}
+}
+
+// notExist converts missing object to error 'not exist', so missing files of all volumes are recognized in the same way
+func notExist(err error, path string) error {
+	var rerr *awshttp.ResponseError
+	if errors.As(err, &rerr) && rerr.HTTPStatusCode() == http.StatusNotFound {
+		return errors.Join(err, &iofs.PathError{Op: "open", Path: path, Err: iofs.ErrNotExist})
+	}
+	return err
+}
+
+func insecureHTTPClient() *awshttp.BuildableClient {
+	return awshttp.NewBuildableClient().WithTransportOptions(func(tr *http.Transport) {
+		if tr.TLSClientConfig == nil {
+			tr.TLSClientConfig = &tls.Config{}
+		}
+		tr.TLSClientConfig.InsecureSkipVerify = true
+	})
+}
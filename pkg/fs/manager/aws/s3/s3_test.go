@@ -0,0 +1,809 @@
+package s3
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/md5"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	s3manager "github.com/aws/aws-sdk-go-v2/feature/s3/manager"
+	"github.com/vilasle/backilli/pkg/fs/manager/conformance"
+	"github.com/vilasle/backilli/pkg/fs/unit"
+)
+
+const testBucket = "backups"
+
+// fakeStorage is a minimal S3 stand-in which supports path-style requests only
+type fakeStorage struct {
+	mx      sync.Mutex
+	objects map[string][]byte
+	etags   map[string]string
+	uploads map[string]map[int][]byte
+	parts   int
+	hosts   []string
+	// authorization headers of requests
+	credentials []string
+	// pageSize - maximum of keys in one page of listing
+	pageSize int
+	listings int
+	batches  int
+	// headers of requests which create objects
+	headers map[string]http.Header
+}
+
+type initiateMultipartUploadResult struct {
+	XMLName  xml.Name `xml:"InitiateMultipartUploadResult"`
+	Bucket   string   `xml:"Bucket"`
+	Key      string   `xml:"Key"`
+	UploadId string   `xml:"UploadId"`
+}
+
+type completeMultipartUpload struct {
+	Parts []struct {
+		PartNumber int `xml:"PartNumber"`
+	} `xml:"Part"`
+}
+
+type completeMultipartUploadResult struct {
+	XMLName xml.Name `xml:"CompleteMultipartUploadResult"`
+	Bucket  string   `xml:"Bucket"`
+	Key     string   `xml:"Key"`
+	ETag    string   `xml:"ETag"`
+}
+
+type listBucketResult struct {
+	XMLName               xml.Name        `xml:"ListBucketResult"`
+	Name                  string          `xml:"Name"`
+	Prefix                string          `xml:"Prefix"`
+	KeyCount              int             `xml:"KeyCount"`
+	MaxKeys               int             `xml:"MaxKeys"`
+	IsTruncated           bool            `xml:"IsTruncated"`
+	NextContinuationToken string          `xml:"NextContinuationToken,omitempty"`
+	Contents              []objectContent `xml:"Contents"`
+	CommonPrefixes        []commonPrefix  `xml:"CommonPrefixes"`
+}
+
+type commonPrefix struct {
+	Prefix string `xml:"Prefix"`
+}
+
+type deleteRequest struct {
+	Objects []struct {
+		Key string `xml:"Key"`
+	} `xml:"Object"`
+}
+
+type deleteResult struct {
+	XMLName xml.Name `xml:"DeleteResult"`
+}
+
+type objectContent struct {
+	Key          string `xml:"Key"`
+	LastModified string `xml:"LastModified"`
+	Size         int    `xml:"Size"`
+}
+
+func newFakeStorage() *fakeStorage {
+	return &fakeStorage{
+		objects: make(map[string][]byte),
+		etags:   make(map[string]string),
+		uploads: make(map[string]map[int][]byte),
+		headers: make(map[string]http.Header),
+		// the same as S3
+		pageSize: 1000,
+	}
+}
+
+func (f *fakeStorage) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mx.Lock()
+	defer f.mx.Unlock()
+
+	f.hosts = append(f.hosts, r.Host)
+	f.credentials = append(f.credentials, r.Header.Get("Authorization"))
+
+	path := strings.TrimPrefix(r.URL.Path, "/")
+	bucket, key, _ := strings.Cut(path, "/")
+	if bucket != testBucket {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	query := r.URL.Query()
+	switch {
+	case r.Method == http.MethodGet && key == "" && query.Get("list-type") == "2":
+		f.list(w, query)
+	case r.Method == http.MethodPost && query.Has("delete"):
+		f.deleteObjects(w, r)
+	case r.Method == http.MethodPost && query.Has("uploads"):
+		id := fmt.Sprintf("upload-%d", len(f.uploads)+1)
+		f.uploads[id] = make(map[int][]byte)
+		f.headers[key] = r.Header.Clone()
+		xml.NewEncoder(w).Encode(initiateMultipartUploadResult{Bucket: bucket, Key: key, UploadId: id})
+	case r.Method == http.MethodPut && query.Has("uploadId"):
+		f.uploadPart(w, r)
+	case r.Method == http.MethodPost && query.Has("uploadId"):
+		f.completeUpload(w, r, key)
+	case r.Method == http.MethodDelete && query.Has("uploadId"):
+		delete(f.uploads, query.Get("uploadId"))
+		w.WriteHeader(http.StatusNoContent)
+	case r.Method == http.MethodPut:
+		content, err := readBody(r)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		f.objects[key] = content
+		f.etags[key] = fmt.Sprintf("%x", md5.Sum(content))
+		f.headers[key] = r.Header.Clone()
+		w.Header().Set("ETag", `"`+f.etags[key]+`"`)
+	case r.Method == http.MethodHead:
+		content, ok := f.objects[key]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Length", strconv.Itoa(len(content)))
+		w.Header().Set("ETag", `"`+f.etags[key]+`"`)
+	case r.Method == http.MethodGet:
+		content, ok := f.objects[key]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write(content)
+	case r.Method == http.MethodDelete:
+		delete(f.objects, key)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.WriteHeader(http.StatusNotImplemented)
+	}
+}
+
+// readBody decodes content which is sent with trailing checksum (Content-Encoding: aws-chunked)
+func readBody(r *http.Request) ([]byte, error) {
+	if !strings.Contains(r.Header.Get("Content-Encoding"), "aws-chunked") {
+		return io.ReadAll(r.Body)
+	}
+
+	rd := bufio.NewReader(r.Body)
+	content := make([]byte, 0)
+	for {
+		line, err := rd.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		size, err := strconv.ParseInt(strings.TrimSpace(strings.Split(line, ";")[0]), 16, 64)
+		if err != nil {
+			return nil, err
+		}
+		if size == 0 {
+			// trailers are not checked
+			return content, nil
+		}
+
+		chunk := make([]byte, size+2)
+		if _, err := io.ReadFull(rd, chunk); err != nil {
+			return nil, err
+		}
+		content = append(content, chunk[:size]...)
+	}
+}
+
+func (f *fakeStorage) uploadPart(w http.ResponseWriter, r *http.Request) {
+	parts, ok := f.uploads[r.URL.Query().Get("uploadId")]
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	number, err := strconv.Atoi(r.URL.Query().Get("partNumber"))
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	content, err := readBody(r)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	parts[number] = content
+	w.Header().Set("ETag", fmt.Sprintf(`"%d"`, number))
+}
+
+func (f *fakeStorage) completeUpload(w http.ResponseWriter, r *http.Request, key string) {
+	id := r.URL.Query().Get("uploadId")
+	parts, ok := f.uploads[id]
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	req := completeMultipartUpload{}
+	if err := xml.NewDecoder(r.Body).Decode(&req); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	content := make([]byte, 0)
+	for _, p := range req.Parts {
+		content = append(content, parts[p.PartNumber]...)
+	}
+	f.objects[key] = content
+	f.etags[key] = fmt.Sprintf("%x-%d", md5.Sum(content), len(req.Parts))
+	f.parts += len(req.Parts)
+	delete(f.uploads, id)
+
+	xml.NewEncoder(w).Encode(completeMultipartUploadResult{Bucket: testBucket, Key: key, ETag: `"complete"`})
+}
+
+// list supports delimiter and continuation token. Page contains no more than pageSize keys and prefixes
+func (f *fakeStorage) list(w http.ResponseWriter, query url.Values) {
+	prefix, delimiter := query.Get("prefix"), query.Get("delimiter")
+	maxKeys := f.pageSize
+	if mk, err := strconv.Atoi(query.Get("max-keys")); err == nil && mk < maxKeys {
+		maxKeys = mk
+	}
+
+	keys := make([]string, 0, len(f.objects))
+	for k := range f.objects {
+		if strings.HasPrefix(k, prefix) {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+
+	res := listBucketResult{
+		Name:    testBucket,
+		Prefix:  prefix,
+		MaxKeys: maxKeys,
+	}
+
+	after := query.Get("continuation-token")
+	seen := make(map[string]bool)
+	for _, k := range keys {
+		entry := k
+		if delimiter != "" {
+			if i := strings.Index(k[len(prefix):], delimiter); i >= 0 {
+				entry = k[:len(prefix)+i+len(delimiter)]
+			}
+		}
+		if entry <= after || seen[entry] {
+			continue
+		}
+		if res.KeyCount == maxKeys {
+			res.IsTruncated = true
+			res.NextContinuationToken = after
+			break
+		}
+		seen[entry] = true
+		res.KeyCount++
+		after = entry
+
+		if entry != k {
+			res.CommonPrefixes = append(res.CommonPrefixes, commonPrefix{Prefix: entry})
+			continue
+		}
+		res.Contents = append(res.Contents, objectContent{
+			Key:          k,
+			LastModified: time.Now().UTC().Format(time.RFC3339),
+			Size:         len(f.objects[k]),
+		})
+	}
+	f.listings++
+
+	w.Header().Set("Content-Type", "application/xml")
+	xml.NewEncoder(w).Encode(res)
+}
+
+func (f *fakeStorage) deleteObjects(w http.ResponseWriter, r *http.Request) {
+	req := deleteRequest{}
+	if err := xml.NewDecoder(r.Body).Decode(&req); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	if len(req.Objects) > 1000 {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	for _, o := range req.Objects {
+		delete(f.objects, o.Key)
+	}
+	f.batches++
+
+	w.Header().Set("Content-Type", "application/xml")
+	xml.NewEncoder(w).Encode(deleteResult{})
+}
+
+func newTestClient(t *testing.T, srv *httptest.Server) *S3Client {
+	client, err := NewClient(unit.ClientConfig{
+		Endpoint:           srv.URL,
+		Region:             "us-east-1",
+		PathStyle:          true,
+		InsecureSkipVerify: true,
+		BucketName:         testBucket,
+		Root:               "root",
+		KeyId:              "key",
+		KeySecret:          "secret",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return client
+}
+
+func TestWrite(t *testing.T) {
+	storage := newFakeStorage()
+	srv := httptest.NewTLSServer(storage)
+	defer srv.Close()
+
+	client := newTestClient(t, srv)
+
+	testSet := getTestSet()
+	path, err := client.Write(bytes.NewBuffer(testSet), "task/test.txt", unit.WriteOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if path != "backups/root/task/test.txt" {
+		t.Fatalf("unexpected path of object %s", path)
+	}
+
+	if !bytes.Equal(storage.objects["root/task/test.txt"], testSet) {
+		t.Fatal("content of object does not match with test sets")
+	}
+
+	for _, h := range storage.hosts {
+		if strings.HasPrefix(h, testBucket) {
+			t.Fatalf("expected path-style addressing, but bucket is in host %s", h)
+		}
+	}
+}
+
+func TestMultipartWrite(t *testing.T) {
+	storage := newFakeStorage()
+	srv := httptest.NewTLSServer(storage)
+	defer srv.Close()
+
+	client := newTestClient(t, srv)
+
+	defaultPartSize := PartSize
+	PartSize = s3manager.MinUploadPartSize
+	defer func() { PartSize = defaultPartSize }()
+
+	testSet := bytes.Repeat(getTestSet(), 100)
+	// reader without Len or Seek, so uploader can not know size in advance
+	rd := io.MultiReader(bytes.NewReader(testSet))
+	if _, err := client.Write(rd, "task/db.zip", unit.WriteOptions{Size: int64(len(testSet))}); err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(storage.objects["root/task/db.zip"], testSet) {
+		t.Fatal("content of object does not match with test sets")
+	}
+
+	if storage.parts != 3 {
+		t.Fatalf("expected 3 parts of multipart upload, there are %d", storage.parts)
+	}
+
+	if len(storage.uploads) != 0 {
+		t.Fatal("multipart upload was not completed")
+	}
+}
+
+func TestPartSize(t *testing.T) {
+	if size := partSize(0); size != PartSize {
+		t.Fatalf("expected default size of part, there is %d", size)
+	}
+
+	size := PartSize * int64(s3manager.MaxUploadParts) * 2
+	if ps := partSize(size); ps*int64(s3manager.MaxUploadParts) < size {
+		t.Fatalf("size of part %d is too small for content %d", ps, size)
+	}
+}
+
+func TestVerify(t *testing.T) {
+	storage := newFakeStorage()
+	srv := httptest.NewTLSServer(storage)
+	defer srv.Close()
+
+	client := newTestClient(t, srv)
+
+	testSet := getTestSet()
+	sum, err := unit.ComputeChecksum(bytes.NewReader(testSet))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := client.Write(bytes.NewReader(testSet), "task/db.zip", unit.WriteOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.Verify("task/db.zip", sum); err != nil {
+		t.Fatal(err)
+	}
+
+	// content was changed on storage, size is the same
+	storage.objects["root/task/db.zip"][0] = 'X'
+	storage.etags["root/task/db.zip"] = fmt.Sprintf("%x", md5.Sum(storage.objects["root/task/db.zip"]))
+	if err := client.Verify("task/db.zip", sum); !errors.Is(err, unit.ErrChecksumMismatch) {
+		t.Fatalf("expected error of checksum mismatch, there is %v", err)
+	}
+
+	// ETag of multipart upload is not MD5, only size is checked
+	storage.etags["root/task/db.zip"] = "0123456789abcdef-3"
+	if err := client.Verify("task/db.zip", sum); err != nil {
+		t.Fatal(err)
+	}
+
+	storage.objects["root/task/db.zip"] = testSet[:10]
+	if err := client.Verify("task/db.zip", sum); !errors.Is(err, unit.ErrChecksumMismatch) {
+		t.Fatalf("expected error of checksum mismatch, there is %v", err)
+	}
+}
+
+func TestRead(t *testing.T) {
+	storage := newFakeStorage()
+	srv := httptest.NewTLSServer(storage)
+	defer srv.Close()
+
+	testSet := getTestSet()
+	storage.objects["root/task/test.txt"] = testSet
+
+	client := newTestClient(t, srv)
+
+	// key, path which is returned by Write and path relative to root are the same object
+	for _, p := range []string{"root/task/test.txt", testBucket + "/root/task/test.txt", "task/test.txt", "task\\test.txt"} {
+		res, err := client.Read(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !bytes.Equal(res, testSet) {
+			t.Fatalf("content of object %s does not match with test sets", p)
+		}
+	}
+}
+
+func TestLs(t *testing.T) {
+	storage := newFakeStorage()
+	srv := httptest.NewTLSServer(storage)
+	defer srv.Close()
+
+	storage.objects["root/task/01-01-2023/db/db.zip"] = []byte("1")
+	storage.objects["root/task/02-01-2023/db/db.zip"] = []byte("2")
+	storage.objects["root/other/03-01-2023/db/db.zip"] = []byte("3")
+
+	client := newTestClient(t, srv)
+
+	ls, err := client.Ls("task")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	names := make([]string, 0, len(ls))
+	for _, f := range ls {
+		names = append(names, f.Name)
+	}
+	sort.Strings(names)
+
+	if strings.Join(names, ",") != "01-01-2023,02-01-2023" {
+		t.Fatalf("unexpected list of files %v", names)
+	}
+}
+
+func TestLsPagination(t *testing.T) {
+	storage := newFakeStorage()
+	storage.pageSize = 2
+	srv := httptest.NewTLSServer(storage)
+	defer srv.Close()
+
+	expected := make([]string, 0)
+	for i := 1; i <= 7; i++ {
+		date := fmt.Sprintf("%02d-01-2023", i)
+		storage.objects["root/task/"+date+"/db/db.zip"] = []byte("1")
+		storage.objects["root/task/"+date+"/db/db.zip.001"] = []byte("1")
+		expected = append(expected, date)
+	}
+	storage.objects["root/task/plan.json"] = []byte("{}")
+	expected = append(expected, "plan.json")
+
+	client := newTestClient(t, srv)
+
+	ls, err := client.Ls("task")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	names := make([]string, 0, len(ls))
+	for _, f := range ls {
+		names = append(names, f.Name)
+	}
+	sort.Strings(names)
+
+	if strings.Join(names, ",") != strings.Join(expected, ",") {
+		t.Fatalf("unexpected list of files %v", names)
+	}
+
+	if storage.listings != 4 {
+		t.Fatalf("expected 4 pages of listing, there are %d", storage.listings)
+	}
+}
+
+func TestRemoveBatches(t *testing.T) {
+	storage := newFakeStorage()
+	srv := httptest.NewTLSServer(storage)
+	defer srv.Close()
+
+	for i := 0; i < 2500; i++ {
+		storage.objects[fmt.Sprintf("root/task/01-01-2023/db/db.zip.%04d", i)] = []byte("1")
+	}
+	storage.objects["root/task/01-01-2023/db/db.zip"] = []byte("1")
+	// key with the same prefix but in other directory
+	storage.objects["root/task/01-01-2023-old/db/db.zip"] = []byte("1")
+
+	client := newTestClient(t, srv)
+
+	if err := client.Remove("task/01-01-2023"); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(storage.objects) != 1 {
+		t.Fatalf("expected one object after removing, there are %d", len(storage.objects))
+	}
+	if _, ok := storage.objects["root/task/01-01-2023-old/db/db.zip"]; !ok {
+		t.Fatal("object which should not be removed was removed")
+	}
+	if storage.batches != 3 {
+		t.Fatalf("expected 3 batches of deleting, there are %d", storage.batches)
+	}
+
+	// single object
+	storage.objects["root/task/02-01-2023/db/db.zip"] = []byte("2")
+	storage.objects["root/task/02-01-2023/db/db.zip.001"] = []byte("2")
+	if err := client.Remove("task/02-01-2023/db/db.zip"); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := storage.objects["root/task/02-01-2023/db/db.zip.001"]; !ok {
+		t.Fatal("object which should not be removed was removed")
+	}
+}
+
+func TestRemove(t *testing.T) {
+	storage := newFakeStorage()
+	srv := httptest.NewTLSServer(storage)
+	defer srv.Close()
+
+	storage.objects["root/task/01-01-2023/db/db.zip"] = []byte("1")
+	storage.objects["root/task/01-01-2023/db/db.log"] = []byte("1")
+	storage.objects["root/task/02-01-2023/db/db.zip"] = []byte("2")
+
+	client := newTestClient(t, srv)
+
+	if err := client.Remove("task/01-01-2023"); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(storage.objects) != 1 {
+		t.Fatalf("expected one object after removing, there are %d", len(storage.objects))
+	}
+	if _, ok := storage.objects["root/task/02-01-2023/db/db.zip"]; !ok {
+		t.Fatal("object which should not be removed was removed")
+	}
+}
+
+func TestFreeSpace(t *testing.T) {
+	storage := newFakeStorage()
+	storage.pageSize = 2
+	srv := httptest.NewTLSServer(storage)
+	defer srv.Close()
+
+	storage.objects["root/task/01-01-2023/db/db.zip"] = make([]byte, 100)
+	storage.objects["root/task/02-01-2023/db/db.zip"] = make([]byte, 200)
+	storage.objects["root/other/03-01-2023/db/db.zip"] = make([]byte, 300)
+	storage.objects["outside/db.zip"] = make([]byte, 1000)
+
+	client := newTestClient(t, srv)
+	if _, err := client.FreeSpace(); !errors.Is(err, unit.ErrUnknownFreeSpace) {
+		t.Fatalf("volume without quota should not report free space, there is %v", err)
+	}
+
+	client.quota = 1000
+	free, err := client.FreeSpace()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if free != 400 {
+		t.Fatalf("expected 400 bytes of free space, there is %d", free)
+	}
+}
+
+func TestObjectOptions(t *testing.T) {
+	storage := newFakeStorage()
+	srv := httptest.NewTLSServer(storage)
+	defer srv.Close()
+
+	client, err := NewClient(unit.ClientConfig{
+		Endpoint:           srv.URL,
+		Region:             "us-east-1",
+		PathStyle:          true,
+		InsecureSkipVerify: true,
+		BucketName:         testBucket,
+		Root:               "root",
+		KeyId:              "key",
+		KeySecret:          "secret",
+		StorageClass:       "cold",
+		SSE:                "aws:kms",
+		SSEKMSKeyId:        "backup-key",
+		ObjectLockMode:     "compliance",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	content := []byte("content of backup")
+	retain := time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)
+	if _, err := client.Write(bytes.NewReader(content), "task/db.zip", unit.WriteOptions{
+		Size:        int64(len(content)),
+		RetainUntil: retain,
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(storage.objects["root/task/db.zip"], content) {
+		t.Fatalf("unexpected content of object %q", storage.objects["root/task/db.zip"])
+	}
+
+	header := storage.headers["root/task/db.zip"]
+	expected := map[string]string{
+		"X-Amz-Storage-Class":                         "COLD",
+		"X-Amz-Server-Side-Encryption":                "aws:kms",
+		"X-Amz-Server-Side-Encryption-Aws-Kms-Key-Id": "backup-key",
+		"X-Amz-Object-Lock-Mode":                      "COMPLIANCE",
+		"X-Amz-Object-Lock-Retain-Until-Date":         retain.Format(time.RFC3339),
+	}
+	for k, v := range expected {
+		if header.Get(k) != v {
+			t.Fatalf("expected header %s: %s, there is %q", k, v, header.Get(k))
+		}
+	}
+
+	// ETag of object which is encrypted by KMS is not MD5 of content
+	storage.etags["root/task/db.zip"] = "not-md5"
+	sum, err := unit.ComputeChecksum(bytes.NewReader(content))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := client.Verify("task/db.zip", sum); err != nil {
+		t.Fatal(err)
+	}
+
+	// object without retention is not locked
+	if _, err := client.Write(bytes.NewReader(content), "task/unlocked.zip", unit.WriteOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if mode := storage.headers["root/task/unlocked.zip"].Get("X-Amz-Object-Lock-Mode"); mode != "" {
+		t.Fatalf("object without retention should not be locked, there is mode %s", mode)
+	}
+}
+
+func TestUnexpectedObjectOptions(t *testing.T) {
+	confs := []unit.ClientConfig{
+		{SSE: "des"},
+		{SSE: "AES256", SSEKMSKeyId: "backup-key"},
+		{ObjectLockMode: "forever"},
+	}
+	for _, conf := range confs {
+		if _, err := NewClient(conf); err == nil {
+			t.Fatalf("expected error of config %+v", conf)
+		}
+	}
+}
+
+func TestConformance(t *testing.T) {
+	conformance.Run(t, func(t *testing.T) conformance.Volume {
+		srv := httptest.NewTLSServer(newFakeStorage())
+		t.Cleanup(srv.Close)
+		return newTestClient(t, srv)
+	})
+}
+
+func TestCredentialsOfClients(t *testing.T) {
+	storage := newFakeStorage()
+	srv := httptest.NewTLSServer(storage)
+	defer srv.Close()
+
+	os.Unsetenv("AWS_ACCESS_KEY_ID")
+	conf := unit.ClientConfig{
+		Endpoint:           srv.URL,
+		PathStyle:          true,
+		InsecureSkipVerify: true,
+		BucketName:         testBucket,
+		Root:               "root",
+	}
+
+	first, second := conf, conf
+	first.KeyId, first.KeySecret, first.Region = "first-key", "first-secret", "ru-central1"
+	second.KeyId, second.KeySecret, second.Region = "second-key", "second-secret", "eu-west-1"
+
+	firstClient, err := NewClient(first)
+	if err != nil {
+		t.Fatal(err)
+	}
+	secondClient, err := NewClient(second)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := firstClient.Write(bytes.NewBufferString("1"), "first.txt", unit.WriteOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := secondClient.Write(bytes.NewBufferString("2"), "second.txt", unit.WriteOptions{}); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(storage.credentials) != 2 {
+		t.Fatalf("expected 2 requests, there are %d", len(storage.credentials))
+	}
+	if !strings.Contains(storage.credentials[0], "Credential=first-key/") ||
+		!strings.Contains(storage.credentials[0], "/ru-central1/s3/") {
+		t.Fatalf("first client used unexpected credentials %s", storage.credentials[0])
+	}
+	if !strings.Contains(storage.credentials[1], "Credential=second-key/") ||
+		!strings.Contains(storage.credentials[1], "/eu-west-1/s3/") {
+		t.Fatalf("second client used unexpected credentials %s", storage.credentials[1])
+	}
+
+	if os.Getenv("AWS_ACCESS_KEY_ID") != "" {
+		t.Fatal("credentials of client should not be placed into environment")
+	}
+}
+
+func TestUntrustedCertificate(t *testing.T) {
+	srv := httptest.NewTLSServer(newFakeStorage())
+	defer srv.Close()
+
+	client, err := NewClient(unit.ClientConfig{
+		Endpoint:   srv.URL,
+		Region:     "us-east-1",
+		PathStyle:  true,
+		BucketName: testBucket,
+		Root:       "root",
+		KeyId:      "key",
+		KeySecret:  "secret",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := client.Write(bytes.NewBufferString("test"), "test.txt", unit.WriteOptions{}); err == nil {
+		t.Fatal("expected error of TLS verification")
+	}
+}
+
+func getTestSet() []byte {
+	n := 2048
+	p := "AaBbCcDdEeFfGgHhIiJjKkLlMmNnOoPpQqRrSsTtUuVvWwXxYyZz"
+	tp := make([]byte, len(p))
+	for i := 0; i < len(p); i++ {
+		tp[i] = p[i]
+	}
+
+	testSet := make([]byte, 0)
+	for i := 0; i < n; i++ {
+		testSet = append(testSet, tp...)
+	}
+
+	return testSet
+}
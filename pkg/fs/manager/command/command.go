@@ -0,0 +1,221 @@
+package command
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	iofs "io/fs"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/vilasle/backilli/pkg/fs/executing"
+	"github.com/vilasle/backilli/pkg/fs/unit"
+)
+
+const pathPlaceholder = "{path}"
+
+// entry - element of listing in format of "rclone lsjson"
+type entry struct {
+	Path    string    `json:"Path"`
+	Name    string    `json:"Name"`
+	ModTime time.Time `json:"ModTime"`
+	IsDir   bool      `json:"IsDir"`
+}
+
+// CommandClient runs external commands (rclone and etc.) for storages which are not supported natively
+type CommandClient struct {
+	write    []string
+	read     []string
+	ls       []string
+	remove   []string
+	notExist map[int]bool
+	id       string
+	root     string
+}
+
+// conf.Commands - templates of commands, all of them are required
+func NewClient(conf unit.ClientConfig) (*CommandClient, error) {
+	c := &CommandClient{
+		notExist: make(map[int]bool),
+		id:       conf.Id,
+		root:     clean(conf.Root),
+	}
+
+	templates := []struct {
+		name     string
+		template string
+		args     *[]string
+	}{
+		{"write", conf.Commands.Write, &c.write},
+		{"read", conf.Commands.Read, &c.read},
+		{"ls", conf.Commands.Ls, &c.ls},
+		{"remove", conf.Commands.Remove, &c.remove},
+	}
+	for _, t := range templates {
+		args, err := splitCommand(t.template)
+		if err != nil {
+			return nil, errors.Join(err, fmt.Errorf("could not parse command '%s' of volume %s", t.name, conf.Id))
+		}
+		if len(args) == 0 {
+			return nil, fmt.Errorf("command '%s' of volume %s is not defined", t.name, conf.Id)
+		}
+		*t.args = args
+	}
+
+	for _, code := range conf.Commands.NotExistCodes {
+		c.notExist[code] = true
+	}
+	return c, nil
+}
+
+// Read accepts path which was returned by Write (absolute) or path relative to root
+func (c *CommandClient) Read(p string) ([]byte, error) {
+	var stdout bytes.Buffer
+	if err := c.run(c.read, p, nil, &stdout); err != nil {
+		return nil, err
+	}
+	return stdout.Bytes(), nil
+}
+
+// Open runs command of reading in background. Error of command is returned by reading of the end of content
+func (c *CommandClient) Open(p string) (io.ReadCloser, error) {
+	pr, pw := io.Pipe()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		pw.CloseWithError(c.run(c.read, p, nil, pw))
+	}()
+	return &commandReader{PipeReader: pr, done: done}, nil
+}
+
+func (c *CommandClient) Write(rd io.Reader, dst string, opt unit.WriteOptions) (string, error) {
+	if err := c.run(c.write, dst, rd, nil); err != nil {
+		return "", err
+	}
+	return "/" + c.key(dst), nil
+}
+
+func (c *CommandClient) Ls(p string) ([]unit.File, error) {
+	var stdout bytes.Buffer
+	if err := c.run(c.ls, p, nil, &stdout); err != nil {
+		return nil, err
+	}
+
+	entries := make([]entry, 0)
+	if err := json.Unmarshal(stdout.Bytes(), &entries); err != nil {
+		return nil, errors.Join(err, fmt.Errorf("could not parse list of %s from volume %s", p, c.id))
+	}
+
+	res := make([]unit.File, 0, len(entries))
+	for _, e := range entries {
+		name := e.Name
+		if name == "" {
+			name = path.Base(e.Path)
+		}
+		res = append(res, unit.NewFile(name, e.ModTime))
+	}
+	return res, nil
+}
+
+func (c *CommandClient) Remove(p string) error {
+	return c.run(c.remove, p, nil, nil)
+}
+
+func (c *CommandClient) Close() error {
+	return nil
+}
+
+func (c *CommandClient) Description() map[string]any {
+	res := make(map[string]any)
+	res["name"] = "command"
+	res["id"] = c.id
+	res["root"] = c.root
+	return res
+}
+
+// run executes command for path. Error contains output of stderr,
+// exit codes from NotExistCodes are converted to error 'not exist'
+func (c *CommandClient) run(template []string, p string, in io.Reader, out io.Writer) error {
+	key := c.key(p)
+	args := make([]string, len(template))
+	for i, arg := range template {
+		args[i] = strings.ReplaceAll(arg, pathPlaceholder, key)
+	}
+
+	var stderr bytes.Buffer
+	err := executing.ExecuteWithInput(args[0], in, out, &stderr, args[1:]...)
+	if err == nil {
+		return nil
+	}
+
+	var exitErr *executing.ExitError
+	if errors.As(err, &exitErr) && c.notExist[exitErr.Code] {
+		return &iofs.PathError{Op: template[0], Path: key, Err: iofs.ErrNotExist}
+	}
+	return errors.Join(err, fmt.Errorf("command %s failed for %s: %s", args[0], key, strings.TrimSpace(stderr.String())))
+}
+
+// commandReader waits for command when content is closed
+type commandReader struct {
+	*io.PipeReader
+	done chan struct{}
+}
+
+func (r *commandReader) Close() error {
+	err := r.PipeReader.Close()
+	<-r.done
+	return err
+}
+
+// key returns path of file which contains root of client. Absolute path contains root already
+func (c *CommandClient) key(p string) string {
+	if strings.HasPrefix(p, "/") || strings.HasPrefix(p, "\\") {
+		return clean(p)
+	}
+	return clean(path.Join(c.root, clean(p)))
+}
+
+// clean converts path with any separators to form "dir/file" without leading and trailing separators
+func clean(p string) string {
+	p = path.Clean("/" + strings.ReplaceAll(p, "\\", "/"))
+	return strings.TrimPrefix(p, "/")
+}
+
+// splitCommand splits template into arguments by spaces. Quoted (single or double) argument can contain spaces
+func splitCommand(template string) ([]string, error) {
+	var (
+		args    = make([]string, 0)
+		current strings.Builder
+		quote   rune
+		inArg   bool
+	)
+	for _, r := range template {
+		switch {
+		case quote != 0 && r == quote:
+			quote = 0
+		case quote != 0:
+			current.WriteRune(r)
+		case r == '"' || r == '\'':
+			quote, inArg = r, true
+		case r == ' ' || r == '\t':
+			if inArg {
+				args = append(args, current.String())
+				current.Reset()
+				inArg = false
+			}
+		default:
+			current.WriteRune(r)
+			inArg = true
+		}
+	}
+	if quote != 0 {
+		return nil, fmt.Errorf("quote is not closed in '%s'", template)
+	}
+	if inArg {
+		args = append(args, current.String())
+	}
+	return args, nil
+}
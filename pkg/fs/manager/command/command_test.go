@@ -0,0 +1,149 @@
+package command
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/vilasle/backilli/pkg/fs/manager/conformance"
+	"github.com/vilasle/backilli/pkg/fs/unit"
+)
+
+// storageEnv - directory which is used by helper process as remote storage
+const storageEnv = "BACKILLI_COMMAND_STORAGE"
+
+// TestHelperProcess is not real test, it is the external command which is run by client.
+// It works like rclone on directory from environment: rcat, cat, lsjson, purge
+func TestHelperProcess(t *testing.T) {
+	storage := os.Getenv(storageEnv)
+	if storage == "" {
+		return
+	}
+
+	args := os.Args
+	for len(args) > 0 && args[0] != "--" {
+		args = args[1:]
+	}
+	if len(args) != 3 {
+		fmt.Fprintf(os.Stderr, "unexpected arguments %v", os.Args)
+		os.Exit(2)
+	}
+	os.Exit(helper(storage, args[1], filepath.Join(storage, filepath.FromSlash(args[2]))))
+}
+
+func helper(storage, cmd, path string) int {
+	switch cmd {
+	case "rcat":
+		if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+			return fail(err)
+		}
+		content, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			return fail(err)
+		}
+		if err := os.WriteFile(path, content, os.ModePerm); err != nil {
+			return fail(err)
+		}
+	case "cat":
+		content, err := os.ReadFile(path)
+		if os.IsNotExist(err) {
+			return 4
+		} else if err != nil {
+			return fail(err)
+		}
+		os.Stdout.Write(content)
+	case "lsjson":
+		ls, err := os.ReadDir(path)
+		if os.IsNotExist(err) {
+			return 3
+		} else if err != nil {
+			return fail(err)
+		}
+		entries := make([]entry, 0, len(ls))
+		for _, f := range ls {
+			info, err := f.Info()
+			if err != nil {
+				return fail(err)
+			}
+			entries = append(entries, entry{Path: f.Name(), Name: f.Name(), ModTime: info.ModTime(), IsDir: f.IsDir()})
+		}
+		json.NewEncoder(os.Stdout).Encode(entries)
+	case "purge":
+		if err := os.RemoveAll(path); err != nil {
+			return fail(err)
+		}
+	default:
+		return fail(fmt.Errorf("unexpected command %s", cmd))
+	}
+	return 0
+}
+
+func fail(err error) int {
+	fmt.Fprint(os.Stderr, err)
+	return 1
+}
+
+func newTestClient(t *testing.T) *CommandClient {
+	t.Setenv(storageEnv, t.TempDir())
+
+	helper := fmt.Sprintf(`"%s" -test.run=TestHelperProcess --`, os.Args[0])
+	client, err := NewClient(unit.ClientConfig{
+		Id:   "command",
+		Root: "backups",
+		Commands: unit.CommandTemplates{
+			Write:         helper + " rcat {path}",
+			Read:          helper + " cat {path}",
+			Ls:            helper + " lsjson {path}",
+			Remove:        helper + " purge {path}",
+			NotExistCodes: []int{3, 4},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return client
+}
+
+func TestConformance(t *testing.T) {
+	conformance.Run(t, func(t *testing.T) conformance.Volume {
+		return newTestClient(t)
+	})
+}
+
+func TestCommandError(t *testing.T) {
+	client := newTestClient(t)
+
+	if _, err := client.Read("missing.zip"); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("expected error 'not exist', there is %v", err)
+	}
+
+	// error of command contains its stderr
+	client.ls = append(client.ls[:len(client.ls)-2], "unknown", "{path}")
+	if _, err := client.Ls("task"); err == nil || !strings.Contains(err.Error(), "unexpected command unknown") {
+		t.Fatalf("expected error with output of command, there is %v", err)
+	}
+}
+
+func TestSplitCommand(t *testing.T) {
+	args, err := splitCommand(`rclone  rcat "my remote:{path}" --header 'X-Name: a b'`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{"rclone", "rcat", "my remote:{path}", "--header", "X-Name: a b"}
+	if strings.Join(args, "|") != strings.Join(expected, "|") {
+		t.Fatalf("expected arguments %q, there are %q", expected, args)
+	}
+
+	if _, err := splitCommand(`rclone "rcat`); err == nil {
+		t.Fatal("expected error of not closed quote")
+	}
+
+	if _, err := NewClient(unit.ClientConfig{Commands: unit.CommandTemplates{Write: "rclone rcat {path}"}}); err == nil {
+		t.Fatal("expected error of not defined commands")
+	}
+}
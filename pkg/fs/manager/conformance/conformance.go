@@ -0,0 +1,267 @@
+// Package conformance contains tests which every implementation of volume has to pass.
+// Process relies on this behaviour when it sends backups and clears old copies
+package conformance
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/vilasle/backilli/pkg/fs/unit"
+)
+
+// Volume - operations of volume which are checked (manager.ManagerAtomic)
+type Volume interface {
+	Read(string) ([]byte, error)
+	Open(string) (io.ReadCloser, error)
+	Write(io.Reader, string, unit.WriteOptions) (string, error)
+	Ls(string) ([]unit.File, error)
+	Remove(string) error
+}
+
+// Run checks volume. newVolume has to return volume with root which is not empty and does not contain files
+// for every test, so paths relative to root differ from paths which are returned by Write
+func Run(t *testing.T, newVolume func(t *testing.T) Volume) {
+	tests := []struct {
+		name string
+		test func(t *testing.T, v Volume)
+	}{
+		{"WriteAndRead", testWriteAndRead},
+		{"ReadListed", testReadListed},
+		{"Open", testOpen},
+		{"OpenMissing", testOpenMissing},
+		{"NestedWrite", testNestedWrite},
+		{"LsMissingDir", testLsMissingDir},
+		{"LsFile", testLsFile},
+		{"Overwrite", testOverwrite},
+		{"RecursiveRemove", testRecursiveRemove},
+		{"RemoveMissing", testRemoveMissing},
+		{"PathSeparators", testPathSeparators},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.test(t, newVolume(t))
+		})
+	}
+}
+
+// content returns content which is larger than buffers of volumes
+func content(seed string) []byte {
+	return bytes.Repeat([]byte(seed), 256*1024/len(seed)+1)
+}
+
+func write(t *testing.T, v Volume, dst string, content []byte) string {
+	t.Helper()
+	path, err := v.Write(bytes.NewReader(content), dst, unit.WriteOptions{Size: int64(len(content))})
+	if err != nil {
+		t.Fatalf("could not write %s: %v", dst, err)
+	}
+	return path
+}
+
+func names(t *testing.T, v Volume, path string) []string {
+	t.Helper()
+	ls, err := v.Ls(path)
+	if err != nil {
+		t.Fatalf("could not list %s: %v", path, err)
+	}
+	res := make([]string, 0, len(ls))
+	for _, f := range ls {
+		res = append(res, f.Name)
+	}
+	sort.Strings(res)
+	return res
+}
+
+func expectNames(t *testing.T, v Volume, path string, expected ...string) {
+	t.Helper()
+	if ls := names(t, v, path); strings.Join(ls, ",") != strings.Join(expected, ",") {
+		t.Fatalf("expected %v under %s, there are %v", expected, path, ls)
+	}
+}
+
+// expectMissing checks directory which does not exist. Volumes without directories
+// (object storages) return empty list, others return error 'not exist'
+func expectMissing(t *testing.T, v Volume, path string) {
+	t.Helper()
+	ls, err := v.Ls(path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("expected error 'not exist' of %s, there is %v", path, err)
+	}
+	if len(ls) != 0 {
+		t.Fatalf("expected missing directory %s, there are %v", path, ls)
+	}
+}
+
+// testWriteAndRead - path which is returned by Write is accepted by Read
+func testWriteAndRead(t *testing.T, v Volume) {
+	expected := content("write and read ")
+	path := write(t, v, "db.zip", expected)
+
+	res, err := v.Read(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(res, expected) {
+		t.Fatalf("content was changed, expected %d bytes, there are %d bytes", len(expected), len(res))
+	}
+}
+
+// testReadListed - copies are found by Ls and read by relative path (replication, repository, tiering)
+func testReadListed(t *testing.T, v Volume) {
+	expected := content("read listed ")
+	write(t, v, "task/01-01-2023/db/db.zip", expected)
+
+	for _, name := range names(t, v, "task/01-01-2023/db") {
+		res, err := v.Read(path.Join("task/01-01-2023/db", name))
+		if err != nil {
+			t.Fatalf("could not read listed file by path relative to root: %v", err)
+		}
+		if !bytes.Equal(res, expected) {
+			t.Fatal("content was changed")
+		}
+	}
+	expectNames(t, v, "task/01-01-2023/db", "db.zip")
+}
+
+// testOpen - file is streamed by path which is returned by Write or by path relative to root,
+// volume is usable when stream is closed
+func testOpen(t *testing.T, v Volume) {
+	expected := content("open ")
+	written := write(t, v, "task/db.zip", expected)
+
+	for _, p := range []string{written, "task/db.zip"} {
+		rc, err := v.Open(p)
+		if err != nil {
+			t.Fatalf("could not open %s: %v", p, err)
+		}
+		res, err := io.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			t.Fatalf("could not read %s: %v", p, err)
+		}
+		if !bytes.Equal(res, expected) {
+			t.Fatalf("content of %s was changed, expected %d bytes, there are %d bytes", p, len(expected), len(res))
+		}
+	}
+
+	// stream is closed before the end of content
+	rc, err := v.Open(written)
+	if err != nil {
+		t.Fatal(err)
+	}
+	io.ReadFull(rc, make([]byte, 16))
+	rc.Close()
+
+	write(t, v, "task/log.txt", content("after open "))
+	expectNames(t, v, "task", "db.zip", "log.txt")
+}
+
+// testOpenMissing - missing file is reported as 'not exist' by opening or by reading
+func testOpenMissing(t *testing.T, v Volume) {
+	rc, err := v.Open("task/missing.zip")
+	if err == nil {
+		_, err = io.ReadAll(rc)
+		rc.Close()
+	}
+	if !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("expected error 'not exist', there is %v", err)
+	}
+}
+
+// testNestedWrite - missing directories are created by Write
+func testNestedWrite(t *testing.T, v Volume) {
+	write(t, v, "task/01-01-2023/db/db.zip", content("nested "))
+	write(t, v, "task/02-01-2023/db/db.zip", content("nested "))
+
+	expectNames(t, v, "", "task")
+	expectNames(t, v, "task", "01-01-2023", "02-01-2023")
+	expectNames(t, v, "task/01-01-2023/db", "db.zip")
+}
+
+// testLsMissingDir - ClearOldCopies skips volumes which do not have copies of task
+func testLsMissingDir(t *testing.T, v Volume) {
+	write(t, v, "task/db.zip", content("missing "))
+	expectMissing(t, v, "other")
+	expectMissing(t, v, "task/other")
+}
+
+func testLsFile(t *testing.T, v Volume) {
+	write(t, v, "task/db.zip", content("file "))
+	if ls, err := v.Ls("task/db.zip"); err == nil && len(ls) != 0 {
+		t.Fatalf("file should not be listed as directory, there are %v", ls)
+	}
+}
+
+// testOverwrite - repeated backup replaces file with the same name
+func testOverwrite(t *testing.T, v Volume) {
+	write(t, v, "task/db.zip", content("first "))
+	expected := content("second and longer ")
+	path := write(t, v, "task/db.zip", expected)
+
+	res, err := v.Read(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(res, expected) {
+		t.Fatal("file was not overwritten")
+	}
+	expectNames(t, v, "task", "db.zip")
+
+	short := []byte("short")
+	path = write(t, v, "task/db.zip", short)
+	if res, err = v.Read(path); err != nil || !bytes.Equal(res, short) {
+		t.Fatalf("overwritten file has to be truncated, there is %d bytes, %v", len(res), err)
+	}
+}
+
+// testRecursiveRemove - old copy is removed with all files under it
+func testRecursiveRemove(t *testing.T, v Volume) {
+	write(t, v, "task/01-01-2023/db/db.zip", content("remove "))
+	write(t, v, "task/01-01-2023/db/db.log", content("remove "))
+	write(t, v, "task/01-01-2023/files/files.zip", content("remove "))
+	write(t, v, "task/02-01-2023/db/db.zip", content("keep "))
+
+	if err := v.Remove("task/01-01-2023/db"); err != nil {
+		t.Fatal(err)
+	}
+	expectNames(t, v, "task/01-01-2023", "files")
+
+	if err := v.Remove("task/01-01-2023"); err != nil {
+		t.Fatal(err)
+	}
+	expectMissing(t, v, "task/01-01-2023")
+	expectNames(t, v, "task", "02-01-2023")
+	expectNames(t, v, "task/02-01-2023/db", "db.zip")
+}
+
+func testRemoveMissing(t *testing.T, v Volume) {
+	write(t, v, "task/db.zip", content("missing "))
+	if err := v.Remove("task/other.zip"); err != nil && !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("expected error 'not exist', there is %v", err)
+	}
+	expectNames(t, v, "task", "db.zip")
+}
+
+// testPathSeparators - entities build paths with separator of OS, volumes accept them
+func testPathSeparators(t *testing.T, v Volume) {
+	expected := content("separators ")
+	path := write(t, v, filepath.Join("task", "01-01-2023", "db.zip"), expected)
+
+	expectNames(t, v, "task/01-01-2023", "db.zip")
+	expectNames(t, v, filepath.Join("task", "01-01-2023"), "db.zip")
+
+	res, err := v.Read(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(res, expected) {
+		t.Fatal("content was changed")
+	}
+}
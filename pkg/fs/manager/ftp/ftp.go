@@ -0,0 +1,340 @@
+package ftp
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	iofs "io/fs"
+	"net"
+	"net/textproto"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	ftpclient "github.com/jlaffaye/ftp"
+	"github.com/vilasle/backilli/pkg/fs"
+	"github.com/vilasle/backilli/pkg/fs/unit"
+)
+
+const (
+	ExplicitTLS = "explicit"
+	ImplicitTLS = "implicit"
+)
+
+const connectTimeout = 30 * time.Second
+
+// FtpClient uses one control connection, so all operations are serialized.
+// Data connections are always passive (EPSV or PASV if EPSV is disabled)
+type FtpClient struct {
+	mx       *sync.Mutex
+	conn     *ftpclient.ServerConn
+	address  string
+	user     string
+	password string
+	tlsMode  string
+	options  []ftpclient.DialOption
+	home     string
+	id       string
+	root     string
+}
+
+// conf.TLSMode - "explicit" (AUTH TLS), "implicit" or empty for plain FTP
+// conf.DisableEPSV - use PASV instead of EPSV for opening data connections
+// conf.InsecureSkipVerify - does not verify TLS certificate of server
+func NewClient(conf unit.ClientConfig) (*FtpClient, error) {
+	options := []ftpclient.DialOption{
+		ftpclient.DialWithTimeout(connectTimeout),
+		ftpclient.DialWithDisabledEPSV(conf.DisableEPSV),
+	}
+
+	tlsConfig := &tls.Config{
+		ServerName:         conf.Host,
+		InsecureSkipVerify: conf.InsecureSkipVerify,
+		ClientSessionCache: tls.NewLRUClientSessionCache(0),
+	}
+
+	switch conf.TLSMode {
+	case "":
+	case ExplicitTLS:
+		options = append(options, ftpclient.DialWithExplicitTLS(tlsConfig))
+	case ImplicitTLS:
+		options = append(options, ftpclient.DialWithTLS(tlsConfig))
+	default:
+		return nil, fmt.Errorf("unexpected tls mode '%s' of ftp", conf.TLSMode)
+	}
+
+	c := &FtpClient{
+		mx:       &sync.Mutex{},
+		address:  net.JoinHostPort(conf.Host, strconv.Itoa(conf.Port)),
+		user:     conf.User,
+		password: conf.Password,
+		tlsMode:  conf.TLSMode,
+		options:  options,
+		id:       conf.Id,
+		root:     conf.Root,
+	}
+
+	if err := c.connect(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// Read accepts path which was returned by Write or path relative to root
+func (c *FtpClient) Read(path string) ([]byte, error) {
+	rc, err := c.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	return io.ReadAll(rc)
+}
+
+// Open keeps connection busy till file is closed, because connection transfers one file at a time
+func (c *FtpClient) Open(path string) (io.ReadCloser, error) {
+	c.mx.Lock()
+
+	conn, err := c.alive()
+	if err != nil {
+		c.mx.Unlock()
+		return nil, err
+	}
+
+	if !fs.InRoot(c.fullPath(""), path) {
+		path = c.fullPath(path)
+	}
+	resp, err := conn.Retr(path)
+	if err != nil {
+		c.mx.Unlock()
+		return nil, notExist(err, path)
+	}
+	return &ftpReader{Response: resp, unlock: c.mx.Unlock}, nil
+}
+
+func (c *FtpClient) Write(rd io.Reader, dst string, opt unit.WriteOptions) (string, error) {
+	c.mx.Lock()
+	defer c.mx.Unlock()
+
+	conn, err := c.alive()
+	if err != nil {
+		return "", err
+	}
+
+	fpf := c.fullPath(dst)
+	if err := c.mkdirAll(conn, path.Dir(fpf)); err != nil {
+		return "", err
+	}
+
+	if err := conn.Stor(fpf, rd); err != nil {
+		return "", err
+	}
+	return fpf, nil
+}
+
+// Verify downloads file which was written by Write and compares it with checksum of source
+func (c *FtpClient) Verify(dst string, sum unit.Checksum) error {
+	c.mx.Lock()
+	defer c.mx.Unlock()
+
+	conn, err := c.alive()
+	if err != nil {
+		return err
+	}
+
+	fpf := c.fullPath(dst)
+	resp, err := conn.Retr(fpf)
+	if err != nil {
+		return notExist(err, fpf)
+	}
+	defer resp.Close()
+
+	return sum.Compare(resp)
+}
+
+func (c *FtpClient) Ls(p string) ([]unit.File, error) {
+	c.mx.Lock()
+	defer c.mx.Unlock()
+
+	conn, err := c.alive()
+	if err != nil {
+		return nil, err
+	}
+
+	dir := c.fullPath(p)
+	if !c.isDir(conn, dir) {
+		return nil, &iofs.PathError{Op: "ls", Path: dir, Err: os.ErrNotExist}
+	}
+
+	ls, err := conn.List(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	res := make([]unit.File, 0, len(ls))
+	for _, e := range ls {
+		if e.Name == "." || e.Name == ".." {
+			continue
+		}
+		res = append(res, unit.NewFile(e.Name, e.Time))
+	}
+	return res, nil
+}
+
+func (c *FtpClient) Remove(p string) error {
+	c.mx.Lock()
+	defer c.mx.Unlock()
+
+	conn, err := c.alive()
+	if err != nil {
+		return err
+	}
+
+	return c.removeAll(conn, c.fullPath(p))
+}
+
+func (c *FtpClient) Close() error {
+	c.mx.Lock()
+	defer c.mx.Unlock()
+
+	if c.conn == nil {
+		return nil
+	}
+	err := c.conn.Quit()
+	c.conn = nil
+	return err
+}
+
+func (c *FtpClient) Description() map[string]any {
+	res := make(map[string]any)
+	res["name"] = "ftp"
+	res["id"] = c.id
+	res["host"] = c.address
+	res["root"] = c.root
+	res["tls"] = c.tlsMode
+	return res
+}
+
+func (c *FtpClient) connect() error {
+	conn, err := ftpclient.Dial(c.address, c.options...)
+	if err != nil {
+		return errors.Join(err, fmt.Errorf("could not connect to %s", c.address))
+	}
+
+	if err := conn.Login(c.user, c.password); err != nil {
+		conn.Quit()
+		return errors.Join(err, fmt.Errorf("could not login to %s", c.address))
+	}
+
+	home, err := conn.CurrentDir()
+	if err != nil {
+		conn.Quit()
+		return err
+	}
+
+	c.conn, c.home = conn, home
+	return nil
+}
+
+// alive returns connection and reconnects if server closed idle session.
+// It happens often because dumping can take several hours
+func (c *FtpClient) alive() (*ftpclient.ServerConn, error) {
+	if c.conn != nil {
+		if err := c.conn.NoOp(); err == nil {
+			return c.conn, nil
+		}
+		c.conn.Quit()
+		c.conn = nil
+	}
+
+	if err := c.connect(); err != nil {
+		return nil, err
+	}
+	return c.conn, nil
+}
+
+func (c *FtpClient) fullPath(p string) string {
+	root := c.root
+	if !path.IsAbs(root) {
+		root = path.Join(c.home, root)
+	}
+	return path.Join(root, filepath.ToSlash(p))
+}
+
+func (c *FtpClient) isDir(conn *ftpclient.ServerConn, p string) bool {
+	if err := conn.ChangeDir(p); err != nil {
+		return false
+	}
+	conn.ChangeDir(c.home)
+	return true
+}
+
+func (c *FtpClient) mkdirAll(conn *ftpclient.ServerConn, p string) error {
+	if c.isDir(conn, p) {
+		return nil
+	}
+
+	cur := "/"
+	for _, part := range strings.Split(p, "/") {
+		if part == "" {
+			continue
+		}
+		cur = path.Join(cur, part)
+		if c.isDir(conn, cur) {
+			continue
+		}
+		if err := conn.MakeDir(cur); err != nil {
+			return errors.Join(err, fmt.Errorf("could not create directory %s", cur))
+		}
+	}
+	return nil
+}
+
+func (c *FtpClient) removeAll(conn *ftpclient.ServerConn, p string) error {
+	if !c.isDir(conn, p) {
+		if err := conn.Delete(p); err != nil && !os.IsNotExist(notExist(err, p)) {
+			return err
+		}
+		return nil
+	}
+
+	ls, err := conn.List(p)
+	if err != nil {
+		return err
+	}
+
+	for _, e := range ls {
+		if e.Name == "." || e.Name == ".." {
+			continue
+		}
+		if err := c.removeAll(conn, path.Join(p, e.Name)); err != nil {
+			return err
+		}
+	}
+	return conn.RemoveDir(p)
+}
+
+// notExist converts reply 'file unavailable' to error which is checked by os.IsNotExist
+func notExist(err error, p string) error {
+	var perr *textproto.Error
+	if errors.As(err, &perr) && perr.Code == ftpclient.StatusFileUnavailable {
+		return &iofs.PathError{Op: "ftp", Path: p, Err: os.ErrNotExist}
+	}
+	return err
+}
+
+// ftpReader releases connection when transfer of file is closed
+type ftpReader struct {
+	*ftpclient.Response
+	unlock func()
+	once   sync.Once
+}
+
+func (r *ftpReader) Close() error {
+	defer r.once.Do(r.unlock)
+	return r.Response.Close()
+}
@@ -0,0 +1,473 @@
+package ftp
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"fmt"
+	"io"
+	"math/big"
+	"net"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/vilasle/backilli/pkg/fs/manager/conformance"
+	"github.com/vilasle/backilli/pkg/fs/unit"
+)
+
+const (
+	testUser     = "backup"
+	testPassword = "secret"
+)
+
+// testServer is a minimal FTP server which serves files from local directory
+type testServer struct {
+	listener  net.Listener
+	base      string
+	tlsMode   string
+	tlsConfig *tls.Config
+	mx        sync.Mutex
+	commands  []string
+}
+
+func newTestServer(t *testing.T, tlsMode string) *testServer {
+	srv := &testServer{
+		base:      t.TempDir(),
+		tlsMode:   tlsMode,
+		tlsConfig: testTLSConfig(t),
+	}
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tlsMode == ImplicitTLS {
+		listener = tls.NewListener(listener, srv.tlsConfig)
+	}
+	srv.listener = listener
+
+	go srv.serve()
+	t.Cleanup(func() { listener.Close() })
+	return srv
+}
+
+func (s *testServer) clientConfig(root string) unit.ClientConfig {
+	addr := s.listener.Addr().(*net.TCPAddr)
+	return unit.ClientConfig{
+		Host:               addr.IP.String(),
+		Port:               addr.Port,
+		User:               testUser,
+		Password:           testPassword,
+		Root:               root,
+		TLSMode:            s.tlsMode,
+		InsecureSkipVerify: true,
+	}
+}
+
+func (s *testServer) used(cmd string) bool {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	for _, c := range s.commands {
+		if c == cmd {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *testServer) serve() {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		go s.handle(conn)
+	}
+}
+
+type session struct {
+	srv      *testServer
+	conn     net.Conn
+	rd       *bufio.Reader
+	cwd      string
+	protData bool
+	data     net.Listener
+}
+
+func (s *testServer) handle(conn net.Conn) {
+	ss := &session{srv: s, conn: conn, rd: bufio.NewReader(conn), cwd: "/"}
+	defer conn.Close()
+
+	ss.reply("220 ready")
+	for {
+		line, err := ss.rd.ReadString('\n')
+		if err != nil {
+			return
+		}
+		cmd, arg, _ := strings.Cut(strings.TrimRight(line, "\r\n"), " ")
+		cmd = strings.ToUpper(cmd)
+
+		s.mx.Lock()
+		s.commands = append(s.commands, cmd)
+		s.mx.Unlock()
+
+		if !ss.exec(cmd, arg) {
+			return
+		}
+	}
+}
+
+func (ss *session) reply(format string, args ...any) {
+	fmt.Fprintf(ss.conn, format+"\r\n", args...)
+}
+
+func (ss *session) local(p string) string {
+	if !path.IsAbs(p) {
+		p = path.Join(ss.cwd, p)
+	}
+	return filepath.Join(ss.srv.base, filepath.FromSlash(path.Clean(p)))
+}
+
+func (ss *session) exec(cmd string, arg string) bool {
+	switch cmd {
+	case "AUTH":
+		ss.reply("234 ok")
+		tc := tls.Server(ss.conn, ss.srv.tlsConfig)
+		ss.conn, ss.rd = tc, bufio.NewReader(tc)
+	case "USER":
+		ss.reply("331 password required")
+	case "PASS":
+		if arg != testPassword {
+			ss.reply("530 login incorrect")
+			return true
+		}
+		ss.reply("230 logged in")
+	case "FEAT":
+		ss.reply("211-Features:\r\n MLST type*;modify*;\r\n211 End")
+	case "TYPE", "PBSZ", "NOOP":
+		ss.reply("200 ok")
+	case "PROT":
+		ss.protData = arg == "P"
+		ss.reply("200 ok")
+	case "PWD":
+		ss.reply("257 \"%s\" is current directory", ss.cwd)
+	case "CWD":
+		if st, err := os.Stat(ss.local(arg)); err != nil || !st.IsDir() {
+			ss.reply("550 not a directory")
+			return true
+		}
+		ss.cwd = path.Clean(path.Join(ss.cwd, arg))
+		if path.IsAbs(arg) {
+			ss.cwd = path.Clean(arg)
+		}
+		ss.reply("250 ok")
+	case "CDUP":
+		ss.cwd = path.Dir(ss.cwd)
+		ss.reply("250 ok")
+	case "MKD":
+		if err := os.Mkdir(ss.local(arg), os.ModePerm); err != nil {
+			ss.reply("550 %v", err)
+			return true
+		}
+		ss.reply("257 created")
+	case "RMD":
+		if err := os.Remove(ss.local(arg)); err != nil {
+			ss.reply("550 %v", err)
+			return true
+		}
+		ss.reply("250 ok")
+	case "DELE":
+		if st, err := os.Stat(ss.local(arg)); err != nil || st.IsDir() {
+			ss.reply("550 no such file")
+			return true
+		}
+		os.Remove(ss.local(arg))
+		ss.reply("250 ok")
+	case "EPSV", "PASV":
+		ss.openPassive(cmd)
+	case "STOR":
+		fd, err := os.Create(ss.local(arg))
+		if err != nil {
+			ss.reply("550 %v", err)
+			return true
+		}
+		defer fd.Close()
+		ss.transfer(func(c net.Conn) { io.Copy(fd, c) })
+	case "RETR":
+		content, err := os.ReadFile(ss.local(arg))
+		if err != nil {
+			ss.reply("550 no such file")
+			return true
+		}
+		ss.transfer(func(c net.Conn) { c.Write(content) })
+	case "MLSD":
+		ls, err := os.ReadDir(ss.local(arg))
+		if err != nil {
+			ss.reply("550 no such directory")
+			return true
+		}
+		ss.transfer(func(c net.Conn) {
+			for _, f := range ls {
+				kind := "file"
+				if f.IsDir() {
+					kind = "dir"
+				}
+				info, _ := f.Info()
+				fmt.Fprintf(c, "type=%s;modify=%s; %s\r\n",
+					kind, info.ModTime().UTC().Format("20060102150405"), f.Name())
+			}
+		})
+	case "QUIT":
+		ss.reply("221 bye")
+		return false
+	default:
+		ss.reply("502 not implemented")
+	}
+	return true
+}
+
+func (ss *session) openPassive(cmd string) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		ss.reply("425 %v", err)
+		return
+	}
+	ss.data = l
+	port := l.Addr().(*net.TCPAddr).Port
+	if cmd == "EPSV" {
+		ss.reply("229 Entering Extended Passive Mode (|||%d|)", port)
+	} else {
+		ss.reply("227 Entering Passive Mode (127,0,0,1,%d,%d)", port/256, port%256)
+	}
+}
+
+func (ss *session) transfer(fn func(net.Conn)) {
+	if ss.data == nil {
+		ss.reply("425 use EPSV or PASV first")
+		return
+	}
+	defer func() {
+		ss.data.Close()
+		ss.data = nil
+	}()
+
+	ss.reply("150 opening data connection")
+	conn, err := ss.data.Accept()
+	if err != nil {
+		ss.reply("425 %v", err)
+		return
+	}
+	if ss.protData {
+		conn = tls.Server(conn, ss.srv.tlsConfig)
+	}
+	fn(conn)
+	conn.Close()
+	ss.reply("226 transfer complete")
+}
+
+func testTLSConfig(t *testing.T) *tls.Config {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "127.0.0.1"},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &tls.Config{
+		Certificates: []tls.Certificate{{Certificate: [][]byte{der}, PrivateKey: key}},
+	}
+}
+
+func TestWrite(t *testing.T) {
+	for _, mode := range []string{"", ExplicitTLS, ImplicitTLS} {
+		t.Run("tls="+mode, func(t *testing.T) {
+			srv := newTestServer(t, mode)
+
+			client, err := NewClient(srv.clientConfig("backups"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer client.Close()
+
+			testSet := getTestSet()
+			path, err := client.Write(bytes.NewBuffer(testSet), filepath.Join("task", "01-01-2023", "test.txt"), unit.WriteOptions{})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if path != "/backups/task/01-01-2023/test.txt" {
+				t.Fatalf("unexpected path of file %s", path)
+			}
+
+			cnt, err := os.ReadFile(filepath.Join(srv.base, "backups", "task", "01-01-2023", "test.txt"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(cnt, testSet) {
+				t.Fatal("content of file does not match with test sets")
+			}
+		})
+	}
+}
+
+func TestRead(t *testing.T) {
+	srv := newTestServer(t, "")
+
+	testSet := getTestSet()
+	if err := os.WriteFile(filepath.Join(srv.base, "test.txt"), testSet, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	client, err := NewClient(srv.clientConfig(""))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	res, err := client.Read("/test.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(res, testSet) {
+		t.Fatal("content of file does not match with test sets")
+	}
+
+	if _, err := client.Read("/missing.txt"); !os.IsNotExist(err) {
+		t.Fatalf("expected error 'not exist', there is %v", err)
+	}
+}
+
+func TestLs(t *testing.T) {
+	srv := newTestServer(t, "")
+
+	for _, d := range []string{"01-01-2023", "02-01-2023"} {
+		if err := os.MkdirAll(filepath.Join(srv.base, "backups", "task", d), os.ModePerm); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	client, err := NewClient(srv.clientConfig("backups"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	ls, err := client.Ls("task")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	names := make([]string, 0, len(ls))
+	for _, f := range ls {
+		names = append(names, f.Name)
+	}
+	sort.Strings(names)
+
+	if strings.Join(names, ",") != "01-01-2023,02-01-2023" {
+		t.Fatalf("unexpected list of files %v", names)
+	}
+
+	if _, err := client.Ls("missing"); !os.IsNotExist(err) {
+		t.Fatalf("expected error 'not exist', there is %v", err)
+	}
+}
+
+func TestRemove(t *testing.T) {
+	srv := newTestServer(t, "")
+
+	dir := filepath.Join(srv.base, "backups", "task", "01-01-2023", "db")
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range []string{"db.zip.001", "db.zip.002"} {
+		if err := os.WriteFile(filepath.Join(dir, f), getTestSet(), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	client, err := NewClient(srv.clientConfig("backups"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	if err := client.Remove("task/01-01-2023"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := os.Stat(filepath.Join(srv.base, "backups", "task", "01-01-2023")); !os.IsNotExist(err) {
+		t.Fatal("directory is exist but should be removed")
+	}
+
+	if err := client.Remove("task/missing"); err != nil {
+		t.Fatalf("removing of missing file should not return error, there is %v", err)
+	}
+}
+
+func TestDisableEPSV(t *testing.T) {
+	srv := newTestServer(t, "")
+
+	conf := srv.clientConfig("")
+	conf.DisableEPSV = true
+
+	client, err := NewClient(conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	if _, err := client.Write(bytes.NewBufferString("test"), "test.txt", unit.WriteOptions{}); err != nil {
+		t.Fatal(err)
+	}
+
+	if !srv.used("PASV") || srv.used("EPSV") {
+		t.Fatal("expected that data connection is opened by PASV")
+	}
+}
+
+func getTestSet() []byte {
+	n := 2048
+	p := "AaBbCcDdEeFfGgHhIiJjKkLlMmNnOoPpQqRrSsTtUuVvWwXxYyZz"
+	tp := make([]byte, len(p))
+	for i := 0; i < len(p); i++ {
+		tp[i] = p[i]
+	}
+
+	testSet := make([]byte, 0)
+	for i := 0; i < n; i++ {
+		testSet = append(testSet, tp...)
+	}
+
+	return testSet
+}
+
+func TestConformance(t *testing.T) {
+	conformance.Run(t, func(t *testing.T) conformance.Volume {
+		srv := newTestServer(t, "")
+		client, err := NewClient(srv.clientConfig("backups"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { client.Close() })
+		return client
+	})
+}
@@ -1,61 +1,44 @@
 package local
 
 import (
-	"bytes"
 	"fmt"
 	"io"
 	"os"
-	"strings"
+	"path/filepath"
 
 	"github.com/vilasle/backilli/pkg/fs"
 	"github.com/vilasle/backilli/pkg/fs/unit"
 )
 
 type LocalClient struct {
+	id   string
 	root string
 }
 
 func NewClient(conf unit.ClientConfig) LocalClient {
 	return LocalClient{
+		id:   conf.Id,
 		root: conf.Root,
 	}
 }
 
+// Read accepts path which was returned by Write or path relative to root
 func (c LocalClient) Read(path string) ([]byte, error) {
-	fd, err := os.OpenFile(path, os.O_RDWR, os.ModePerm)
-	if err != nil {
-		return nil, err
-	}
-	defer fd.Close()
-
-	stat, err := fd.Stat()
-	if err != nil {
-		return nil, err
-	}
-
-	res := make([]byte, stat.Size())
-	buffer := make([]byte, 2048)
-
-	offs := 0
-	for {
-		n, err := fd.Read(buffer)
+	return os.ReadFile(c.fullPath(path))
+}
 
-		if err == io.EOF {
-			break
-		}
+func (c LocalClient) Open(path string) (io.ReadCloser, error) {
+	return os.Open(c.fullPath(path))
+}
 
-		if err != nil {
-			return nil, err
-		}
-		for i := 0; i < n; i++ {
-			res[(offs + i)] = buffer[i]
-		}
-		offs += len(buffer)
+func (c LocalClient) fullPath(path string) string {
+	if c.root != "" && !fs.InRoot(c.root, path) {
+		return fs.GetFullPath("", c.root, path)
 	}
-	return res, nil
+	return path
 }
 
-func (c LocalClient) Write(rd *bytes.Buffer, dst string) (string, error) {
+func (c LocalClient) Write(rd io.Reader, dst string, opt unit.WriteOptions) (string, error) {
 	_, err := os.Stat(c.root)
 	if err != nil {
 		if os.IsNotExist(err) {
@@ -80,38 +63,72 @@ func (c LocalClient) Write(rd *bytes.Buffer, dst string) (string, error) {
 		}
 	}
 
-	_, err = os.Stat(fpf)
-	if os.IsExist(err) {
-		if err := os.RemoveAll(fpf); err != nil {
-			return "", err
-		}
+	// file is written under temporary name, so interrupted writing does not look like backup
+	tmp := fs.PartialName(fpf)
+	if err := writeFile(tmp, rd); err != nil {
+		os.Remove(tmp)
+		return "", err
 	}
 
-	fd, err := os.OpenFile(fpf, os.O_CREATE|os.O_WRONLY, os.ModePerm)
-	if err != nil {
+	if err := os.Rename(tmp, fpf); err != nil {
+		os.Remove(tmp)
 		return "", err
 	}
+	return fpf, syncDir(fpd)
+}
+
+func writeFile(path string, rd io.Reader) error {
+	fd, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, os.ModePerm)
+	if err != nil {
+		return err
+	}
 	defer fd.Close()
 
 	var bufferOffset int64 = 1024 * 16
 
 	buf := make([]byte, bufferOffset)
+	if _, err := io.CopyBuffer(fd, rd, buf); err != nil {
+		return err
+	}
+	if err := fd.Sync(); err != nil {
+		return err
+	}
+	return fd.Close()
+}
+
+// syncDir flushes renaming to disk. Directories can not be synced on some systems, so it is not an error
+func syncDir(path string) error {
+	fd, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer fd.Close()
+
+	fd.Sync()
+	return nil
+}
+
+// Verify compares file which was written by Write with checksum of source
+func (c LocalClient) Verify(dst string, sum unit.Checksum) error {
+	fd, err := os.Open(fs.GetFullPath("", c.root, dst))
+	if err != nil {
+		return err
+	}
+	defer fd.Close()
+
+	return sum.Compare(fd)
+}
 
+// FreeSpace returns space which is available for writing on disk of root.
+// Root can be not created yet, so the nearest existing parent is checked
+func (c LocalClient) FreeSpace() (int64, error) {
+	p := c.root
 	for {
-		n, err := rd.Read(buf)
-		if err != nil {
-			if err == io.EOF {
-				break
-			}
-			return "", err
+		if _, err := os.Stat(p); err == nil || filepath.Dir(p) == p {
+			return freeSpace(p)
 		}
-		buf := buf[0:n]
-		if _, err := fd.Write(buf); err != nil {
-			return "", err
-		}
-
+		p = filepath.Dir(p)
 	}
-	return fpf, err
 }
 
 func (c LocalClient) Ls(path string) ([]unit.File, error) {
@@ -130,10 +147,13 @@ func (c LocalClient) Ls(path string) ([]unit.File, error) {
 		return nil, err
 	}
 
-	res := make([]unit.File, len(ls))
-	for i, f := range ls {
+	res := make([]unit.File, 0, len(ls))
+	for _, f := range ls {
+		if fs.IsPartial(f.Name()) {
+			continue
+		}
 		if info, err := f.Info(); err == nil {
-			res[i] = unit.NewFile(info.Name(), info.ModTime())
+			res = append(res, unit.NewFile(info.Name(), info.ModTime()))
 		} else {
 			return res, err
 		}
@@ -142,13 +162,9 @@ func (c LocalClient) Ls(path string) ([]unit.File, error) {
 	return res, nil
 }
 
+// Remove accepts path which was returned by Write or path relative to root
 func (c LocalClient) Remove(path string) error {
-	rmp := path
-	if !strings.Contains(path, c.root) {
-		rmp = fs.GetFullPath("", c.root, path)
-	}
-
-	return os.RemoveAll(rmp)
+	return os.RemoveAll(c.fullPath(path))
 }
 
 func (c LocalClient) Close() error {
@@ -158,6 +174,7 @@ func (c LocalClient) Close() error {
 func (c LocalClient) Description() map[string]any {
 	res := make(map[string]any)
 	res["name"] = "local"
+	res["id"] = c.id
 	res["root"] = c.root
 	return res
 }
\ No newline at end of file
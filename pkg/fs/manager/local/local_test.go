@@ -1,11 +1,17 @@
 package local
 
 import (
+	"bytes"
+	"errors"
 	"fmt"
+	"io"
 	"os"
+	"path/filepath"
 	"testing"
+	"testing/iotest"
 
 	env "github.com/vilasle/backilli/pkg/fs/environment"
+	"github.com/vilasle/backilli/pkg/fs/manager/conformance"
 	"github.com/vilasle/backilli/pkg/fs/unit"
 )
 
@@ -181,6 +187,107 @@ func TestRemove(t *testing.T) {
 	}
 }
 
+func TestVerify(t *testing.T) {
+	root := t.TempDir()
+	client := NewClient(unit.ClientConfig{Root: root})
+
+	testSet := getTestSet()
+	sum, err := unit.ComputeChecksum(bytes.NewReader(testSet))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	path, err := client.Write(bytes.NewReader(testSet), filepath.Join("task", "db.zip"), unit.WriteOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := client.Verify(filepath.Join("task", "db.zip"), sum); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(path, testSet[1:], os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.Verify(filepath.Join("task", "db.zip"), sum); !errors.Is(err, unit.ErrChecksumMismatch) {
+		t.Fatalf("expected error of checksum mismatch, there is %v", err)
+	}
+}
+
+func TestInterruptedWrite(t *testing.T) {
+	root := t.TempDir()
+	client := NewClient(unit.ClientConfig{Root: root})
+
+	testSet := getTestSet()
+	if _, err := client.Write(bytes.NewReader(testSet), filepath.Join("task", "db.zip"), unit.WriteOptions{}); err != nil {
+		t.Fatal(err)
+	}
+
+	errBroken := errors.New("source is broken")
+	rd := io.MultiReader(bytes.NewReader(testSet[:100]), iotest.ErrReader(errBroken))
+	if _, err := client.Write(rd, filepath.Join("task", "db.zip"), unit.WriteOptions{}); !errors.Is(err, errBroken) {
+		t.Fatalf("expected error of source, there is %v", err)
+	}
+
+	content, err := os.ReadFile(filepath.Join(root, "task", "db.zip"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(content, testSet) {
+		t.Fatal("previous file was overwritten by interrupted writing")
+	}
+
+	ls, err := client.Ls("task")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ls) != 1 || ls[0].Name != "db.zip" {
+		t.Fatalf("unexpected files %v", ls)
+	}
+
+	// file which is left by crash is not listed
+	if err := os.WriteFile(filepath.Join(root, "task", "db2.zip.partial"), testSet[:100], os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	if ls, err = client.Ls("task"); err != nil || len(ls) != 1 {
+		t.Fatalf("partial file should not be listed, there is %v, %v", ls, err)
+	}
+}
+
+func TestRemoveInRoot(t *testing.T) {
+	root := filepath.Join(t.TempDir(), "backups")
+	client := NewClient(unit.ClientConfig{Root: root})
+
+	// relative path which contains root is not path of root
+	relative := filepath.Join("copies", root, "db.zip")
+	written, err := client.Write(bytes.NewReader(getTestSet()), relative, unit.WriteOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := client.Remove(relative); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(written); !os.IsNotExist(err) {
+		t.Fatalf("file %s is not removed by relative path: %v", written, err)
+	}
+
+	written, err = client.Write(bytes.NewReader(getTestSet()), filepath.Join("task", "db.zip"), unit.WriteOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := client.Remove(written); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(written); !os.IsNotExist(err) {
+		t.Fatalf("file %s is not removed by path which was returned by Write: %v", written, err)
+	}
+}
+
+func TestConformance(t *testing.T) {
+	conformance.Run(t, func(t *testing.T) conformance.Volume {
+		return NewClient(unit.ClientConfig{Root: t.TempDir()})
+	})
+}
+
 func getTestSet() []byte {
 	n := 2048
 	p := "AaBbCcDdEeFfGgHhIiJjKkLlMmNnOoPpQqRrSsTtUuVvWwXxYyZz"
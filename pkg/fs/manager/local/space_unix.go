@@ -0,0 +1,13 @@
+//go:build unix
+
+package local
+
+import "golang.org/x/sys/unix"
+
+func freeSpace(path string) (int64, error) {
+	var st unix.Statfs_t
+	if err := unix.Statfs(path, &st); err != nil {
+		return 0, err
+	}
+	return int64(uint64(st.Bavail) * uint64(st.Bsize)), nil
+}
@@ -0,0 +1,214 @@
+package memory
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	iofs "io/fs"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/vilasle/backilli/pkg/fs/unit"
+)
+
+type file struct {
+	content []byte
+	date    time.Time
+}
+
+// MemoryClient keeps files in memory till the end of process. Directories are not stored,
+// directory exists while there are files under it. It is used for testing and dry runs
+type MemoryClient struct {
+	mx    *sync.RWMutex
+	files map[string]file
+	id    string
+	root  string
+	quota int64
+}
+
+// conf.Quota - limit of size of files, zero means unlimited
+func NewClient(conf unit.ClientConfig) *MemoryClient {
+	return &MemoryClient{
+		mx:    &sync.RWMutex{},
+		files: make(map[string]file),
+		id:    conf.Id,
+		root:  clean(conf.Root),
+		quota: conf.Quota,
+	}
+}
+
+// Read accepts path which was returned by Write (absolute) or path relative to root
+func (c *MemoryClient) Read(p string) ([]byte, error) {
+	c.mx.RLock()
+	defer c.mx.RUnlock()
+
+	f, ok := c.files[c.key(p)]
+	if !ok {
+		return nil, &iofs.PathError{Op: "read", Path: p, Err: iofs.ErrNotExist}
+	}
+	return bytes.Clone(f.content), nil
+}
+
+// Open returns content which was current at the moment of opening, writing replaces content of file entirely
+func (c *MemoryClient) Open(p string) (io.ReadCloser, error) {
+	c.mx.RLock()
+	defer c.mx.RUnlock()
+
+	f, ok := c.files[c.key(p)]
+	if !ok {
+		return nil, &iofs.PathError{Op: "open", Path: p, Err: iofs.ErrNotExist}
+	}
+	return io.NopCloser(bytes.NewReader(f.content)), nil
+}
+
+func (c *MemoryClient) Write(rd io.Reader, dst string, opt unit.WriteOptions) (string, error) {
+	content, err := io.ReadAll(rd)
+	if err != nil {
+		return "", err
+	}
+
+	c.mx.Lock()
+	defer c.mx.Unlock()
+
+	key := c.key(dst)
+	if c.isDir(key) {
+		return "", &iofs.PathError{Op: "write", Path: dst, Err: iofs.ErrExist}
+	}
+	for dir := path.Dir(key); dir != "." && dir != "/"; dir = path.Dir(dir) {
+		if _, ok := c.files[dir]; ok {
+			return "", fmt.Errorf("file %s is not a directory", dir)
+		}
+	}
+	if c.quota > 0 && c.used()-int64(len(c.files[key].content))+int64(len(content)) > c.quota {
+		return "", fmt.Errorf("quota of volume %s is exceeded", c.id)
+	}
+
+	c.files[key] = file{content: content, date: time.Now()}
+	return "/" + key, nil
+}
+
+// Verify compares file which was written by Write with checksum of source
+func (c *MemoryClient) Verify(dst string, sum unit.Checksum) error {
+	content, err := c.Read(dst)
+	if err != nil {
+		return err
+	}
+	return sum.Compare(bytes.NewReader(content))
+}
+
+// FreeSpace returns difference between quota and size of files
+func (c *MemoryClient) FreeSpace() (int64, error) {
+	if c.quota <= 0 {
+		return 0, unit.ErrUnknownFreeSpace
+	}
+
+	c.mx.RLock()
+	defer c.mx.RUnlock()
+	return c.quota - c.used(), nil
+}
+
+// Ls returns files and directories which are placed directly under path.
+// Date of directory is the latest date of files under it
+func (c *MemoryClient) Ls(p string) ([]unit.File, error) {
+	c.mx.RLock()
+	defer c.mx.RUnlock()
+
+	key := c.key(p)
+	if _, ok := c.files[key]; ok {
+		return nil, fmt.Errorf("file is not a directory")
+	}
+
+	children := make(map[string]time.Time)
+	for k, f := range c.files {
+		name, ok := child(key, k)
+		if !ok {
+			continue
+		}
+		if date, ok := children[name]; !ok || f.date.After(date) {
+			children[name] = f.date
+		}
+	}
+
+	if len(children) == 0 && key != c.root {
+		return nil, &iofs.PathError{Op: "ls", Path: p, Err: iofs.ErrNotExist}
+	}
+
+	res := make([]unit.File, 0, len(children))
+	for name, date := range children {
+		res = append(res, unit.NewFile(name, date))
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].Name < res[j].Name })
+	return res, nil
+}
+
+// Remove deletes file or directory with all files under it. Missing path is not an error
+func (c *MemoryClient) Remove(p string) error {
+	c.mx.Lock()
+	defer c.mx.Unlock()
+
+	key := c.key(p)
+	for k := range c.files {
+		if k == key || strings.HasPrefix(k, key+"/") || key == "" {
+			delete(c.files, k)
+		}
+	}
+	return nil
+}
+
+func (c *MemoryClient) Close() error {
+	return nil
+}
+
+func (c *MemoryClient) Description() map[string]any {
+	res := make(map[string]any)
+	res["name"] = "memory"
+	res["id"] = c.id
+	res["root"] = c.root
+	return res
+}
+
+// key returns path of file which contains root of client. Absolute path contains root already
+func (c *MemoryClient) key(p string) string {
+	if strings.HasPrefix(p, "/") || strings.HasPrefix(p, "\\") {
+		return clean(p)
+	}
+	return clean(path.Join(c.root, clean(p)))
+}
+
+func (c *MemoryClient) isDir(key string) bool {
+	for k := range c.files {
+		if _, ok := child(key, k); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *MemoryClient) used() int64 {
+	var size int64
+	for _, f := range c.files {
+		size += int64(len(f.content))
+	}
+	return size
+}
+
+// child returns name of entry of directory dir which contains file key
+func child(dir, key string) (string, bool) {
+	if dir != "" {
+		if !strings.HasPrefix(key, dir+"/") {
+			return "", false
+		}
+		key = key[len(dir)+1:]
+	}
+	name, _, _ := strings.Cut(key, "/")
+	return name, true
+}
+
+// clean converts path with any separators to form "dir/file" without leading and trailing separators
+func clean(p string) string {
+	p = path.Clean("/" + strings.ReplaceAll(p, "\\", "/"))
+	return strings.TrimPrefix(p, "/")
+}
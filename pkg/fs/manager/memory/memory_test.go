@@ -0,0 +1,40 @@
+package memory
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/vilasle/backilli/pkg/fs/manager/conformance"
+	"github.com/vilasle/backilli/pkg/fs/unit"
+)
+
+func TestConformance(t *testing.T) {
+	conformance.Run(t, func(t *testing.T) conformance.Volume {
+		return NewClient(unit.ClientConfig{Id: "memory", Root: "backups"})
+	})
+}
+
+func TestQuota(t *testing.T) {
+	client := NewClient(unit.ClientConfig{Id: "memory", Quota: 10})
+
+	free, err := client.FreeSpace()
+	if err != nil || free != 10 {
+		t.Fatalf("expected 10 bytes of free space, there is %d, %v", free, err)
+	}
+
+	if _, err := client.Write(bytes.NewReader([]byte("123456")), "a", unit.WriteOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.Write(bytes.NewReader([]byte("123456")), "b", unit.WriteOptions{}); err == nil {
+		t.Fatal("expected error of exceeded quota")
+	}
+	// overwriting does not take space twice
+	if _, err := client.Write(bytes.NewReader([]byte("1234567890")), "a", unit.WriteOptions{}); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := NewClient(unit.ClientConfig{}).FreeSpace(); !errors.Is(err, unit.ErrUnknownFreeSpace) {
+		t.Fatalf("volume without quota should not report free space, there is %v", err)
+	}
+}
@@ -1,31 +1,82 @@
 package manager
 
 import (
-	"bytes"
+	"errors"
 	"fmt"
+	"io"
 
+	"github.com/vilasle/backilli/pkg/fs/manager/aws/s3"
 	"github.com/vilasle/backilli/pkg/fs/manager/aws/yandex"
+	"github.com/vilasle/backilli/pkg/fs/manager/command"
+	"github.com/vilasle/backilli/pkg/fs/manager/ftp"
 	"github.com/vilasle/backilli/pkg/fs/manager/local"
+	"github.com/vilasle/backilli/pkg/fs/manager/memory"
+	"github.com/vilasle/backilli/pkg/fs/manager/sftp"
 	"github.com/vilasle/backilli/pkg/fs/manager/smb"
+	"github.com/vilasle/backilli/pkg/fs/manager/webdav"
 	"github.com/vilasle/backilli/pkg/fs/unit"
 )
 
 const (
-	LOCAL  = 1
-	SMB    = 2
-	YANDEX = 3
+	LOCAL   = 1
+	SMB     = 2
+	YANDEX  = 3
+	S3      = 4
+	SFTP    = 5
+	FTP     = 6
+	WEBDAV  = 7
+	MEMORY  = 8
+	COMMAND = 9
 )
 
 type ManagerAtomic interface {
 	Read(string) ([]byte, error)
-	Write(*bytes.Buffer, string) (string, error)
+	// Open returns content of file as stream, it is used for big files (archives) instead of Read
+	Open(string) (io.ReadCloser, error)
+	Write(io.Reader, string, unit.WriteOptions) (string, error)
 	Ls(string) ([]unit.File, error)
 	Remove(string) error
 	Close() error
 	Description() map[string]any
 }
 
+var (
+	ErrUnverifiable     = errors.New("volume does not support verification of files")
+	ErrUnknownFreeSpace = unit.ErrUnknownFreeSpace
+)
+
+// Verifier - volume which can check file written by Write(..., dst, ...) without trusting result of writing
+type Verifier interface {
+	Verify(dst string, sum unit.Checksum) error
+}
+
+// Capacity - volume which knows how many bytes can be written to it
+type Capacity interface {
+	FreeSpace() (int64, error)
+}
+
+// wrapper - decorator of volume (retrying and etc.)
+type wrapper interface {
+	Unwrap() ManagerAtomic
+}
+
 func NewManager(conf unit.ClientConfig) (ManagerAtomic, error) {
+	mng, err := newClient(conf)
+	if err != nil {
+		return nil, err
+	}
+
+	// retrying is the outer decorator because it rewinds content which is read by others
+	if conf.Bandwidth.Enabled() {
+		mng = NewThrottleManager(mng, conf.Bandwidth)
+	}
+	if conf.Retry.Attempts > 1 {
+		mng = NewRetryManager(mng, conf.Retry)
+	}
+	return mng, nil
+}
+
+func newClient(conf unit.ClientConfig) (ManagerAtomic, error) {
 	switch conf.Type {
 	case LOCAL:
 		return local.NewClient(conf), nil
@@ -33,6 +84,18 @@ func NewManager(conf unit.ClientConfig) (ManagerAtomic, error) {
 		return smb.NewClient(conf)
 	case YANDEX:
 		return yandex.NewClient(conf)
+	case S3:
+		return s3.NewClient(conf)
+	case SFTP:
+		return sftp.NewClient(conf)
+	case FTP:
+		return ftp.NewClient(conf)
+	case WEBDAV:
+		return webdav.NewClient(conf)
+	case MEMORY:
+		return memory.NewClient(conf), nil
+	case COMMAND:
+		return command.NewClient(conf)
 	default:
 		return nil, fmt.Errorf("unexpected kind of file manager")
 	}
@@ -50,3 +113,39 @@ func InitManagersFromConfigs(confs []unit.ClientConfig) (map[string]ManagerAtomi
 	}
 	return mfs, nil
 }
+
+// VolumeId returns identifier of volume from config
+func VolumeId(m ManagerAtomic) string {
+	if id, ok := m.Description()["id"].(string); ok {
+		return id
+	}
+	return ""
+}
+
+// Verify checks file on volume by the first verifier in chain of decorators
+func Verify(m ManagerAtomic, dst string, sum unit.Checksum) error {
+	for {
+		if v, ok := m.(Verifier); ok {
+			return v.Verify(dst, sum)
+		}
+		w, ok := m.(wrapper)
+		if !ok {
+			return ErrUnverifiable
+		}
+		m = w.Unwrap()
+	}
+}
+
+// FreeSpace returns free space of volume by the first capacity in chain of decorators
+func FreeSpace(m ManagerAtomic) (int64, error) {
+	for {
+		if c, ok := m.(Capacity); ok {
+			return c.FreeSpace()
+		}
+		w, ok := m.(wrapper)
+		if !ok {
+			return 0, ErrUnknownFreeSpace
+		}
+		m = w.Unwrap()
+	}
+}
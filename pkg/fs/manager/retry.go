@@ -0,0 +1,166 @@
+package manager
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"os"
+	"time"
+
+	"github.com/vilasle/backilli/pkg/fs/unit"
+	"github.com/vilasle/backilli/pkg/logger"
+)
+
+const (
+	defaultRetryDelay    = time.Second
+	defaultRetryMaxDelay = time.Minute
+)
+
+// RetryManager repeats failed operations of volume with exponential backoff.
+// Writing is repeated only if content can be rewound (it implements io.Seeker)
+type RetryManager struct {
+	mng    ManagerAtomic
+	policy unit.RetryPolicy
+	sleep  func(time.Duration)
+}
+
+func NewRetryManager(mng ManagerAtomic, policy unit.RetryPolicy) *RetryManager {
+	if policy.Delay <= 0 {
+		policy.Delay = defaultRetryDelay
+	}
+	if policy.MaxDelay <= 0 {
+		policy.MaxDelay = defaultRetryMaxDelay
+	}
+	if policy.MaxDelay < policy.Delay {
+		policy.MaxDelay = policy.Delay
+	}
+	return &RetryManager{mng: mng, policy: policy, sleep: time.Sleep}
+}
+
+func (m *RetryManager) Read(p string) (res []byte, err error) {
+	_, err = m.do("read", func() error {
+		res, err = m.mng.Read(p)
+		return err
+	}, nil)
+	return res, err
+}
+
+// Open repeats opening of file only, reading of opened file is not repeated
+func (m *RetryManager) Open(p string) (rc io.ReadCloser, err error) {
+	_, err = m.do("open", func() error {
+		rc, err = m.mng.Open(p)
+		return err
+	}, nil)
+	return rc, err
+}
+
+func (m *RetryManager) Write(rd io.Reader, dst string, opt unit.WriteOptions) (string, error) {
+	path, _, err := m.write(rd, dst, opt)
+	return path, err
+}
+
+func (m *RetryManager) Ls(p string) (res []unit.File, err error) {
+	_, err = m.do("ls", func() error {
+		res, err = m.mng.Ls(p)
+		return err
+	}, nil)
+	return res, err
+}
+
+func (m *RetryManager) Remove(p string) error {
+	_, err := m.do("remove", func() error {
+		return m.mng.Remove(p)
+	}, nil)
+	return err
+}
+
+func (m *RetryManager) Close() error {
+	return m.mng.Close()
+}
+
+func (m *RetryManager) Description() map[string]any {
+	return m.mng.Description()
+}
+
+// Unwrap returns volume which operations are repeated
+func (m *RetryManager) Unwrap() ManagerAtomic {
+	return m.mng
+}
+
+func (m *RetryManager) write(rd io.Reader, dst string, opt unit.WriteOptions) (path string, retries int, err error) {
+	rewind := func() error {
+		return fmt.Errorf("content of %s can not be read again", dst)
+	}
+	if seeker, ok := rd.(io.Seeker); ok {
+		if offset, err := seeker.Seek(0, io.SeekCurrent); err == nil {
+			rewind = func() error {
+				_, err := seeker.Seek(offset, io.SeekStart)
+				return err
+			}
+		}
+	}
+
+	retries, err = m.do("write", func() error {
+		path, err = m.mng.Write(rd, dst, opt)
+		return err
+	}, rewind)
+	return path, retries, err
+}
+
+// do executes operation and returns quantity of repeated attempts
+func (m *RetryManager) do(name string, op func() error, rewind func() error) (int, error) {
+	for attempt := 1; ; attempt++ {
+		err := op()
+		if err == nil || attempt >= m.policy.Attempts || !isRetryable(err) {
+			return attempt - 1, err
+		}
+
+		if rewind != nil {
+			if rerr := rewind(); rerr != nil {
+				return attempt - 1, errors.Join(err, rerr)
+			}
+		}
+
+		delay := m.backoff(attempt)
+		logger.Warn("operation of volume failed, it will be repeated",
+			"operation", name,
+			"volume", m.mng.Description(),
+			"attempt", attempt,
+			"delay", delay.String(),
+			"error", err)
+		m.sleep(delay)
+	}
+}
+
+func (m *RetryManager) backoff(attempt int) time.Duration {
+	delay := m.policy.Delay
+	for i := 1; i < attempt && delay < m.policy.MaxDelay; i++ {
+		delay *= 2
+	}
+	if delay > m.policy.MaxDelay {
+		delay = m.policy.MaxDelay
+	}
+
+	if m.policy.Jitter > 0 {
+		delta := float64(delay) * m.policy.Jitter * (2*rand.Float64() - 1)
+		delay += time.Duration(delta)
+	}
+	return delay
+}
+
+// isRetryable returns false for errors which do not disappear after repeating
+func isRetryable(err error) bool {
+	return !errors.Is(err, os.ErrNotExist) &&
+		!errors.Is(err, os.ErrPermission) &&
+		!errors.Is(err, os.ErrExist)
+}
+
+// WriteWithRetries writes content to volume and returns quantity of repeated attempts
+func WriteWithRetries(m ManagerAtomic, rd io.Reader, dst string, opt unit.WriteOptions) (string, int, error) {
+	if rm, ok := m.(*RetryManager); ok {
+		return rm.write(rd, dst, opt)
+	}
+	path, err := m.Write(rd, dst, opt)
+	return path, 0, err
+}
@@ -0,0 +1,244 @@
+package manager
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/vilasle/backilli/pkg/fs/unit"
+	"github.com/vilasle/backilli/pkg/logger"
+)
+
+var errNetwork = errors.New("connection reset by peer")
+
+// flakyManager fails first operations and keeps content of successful writing
+type flakyManager struct {
+	failures int
+	err      error
+	calls    int
+	content  []byte
+}
+
+func (m *flakyManager) fail() error {
+	m.calls++
+	if m.calls <= m.failures {
+		return m.err
+	}
+	return nil
+}
+
+func (m *flakyManager) Read(p string) ([]byte, error) {
+	if err := m.fail(); err != nil {
+		return nil, err
+	}
+	return m.content, nil
+}
+
+func (m *flakyManager) Open(p string) (io.ReadCloser, error) {
+	if err := m.fail(); err != nil {
+		return nil, err
+	}
+	return io.NopCloser(bytes.NewReader(m.content)), nil
+}
+
+func (m *flakyManager) Write(rd io.Reader, dst string, opt unit.WriteOptions) (string, error) {
+	// partial reading before failure
+	buf := make([]byte, 4)
+	rd.Read(buf)
+	if err := m.fail(); err != nil {
+		return "", err
+	}
+
+	rest, err := io.ReadAll(rd)
+	if err != nil {
+		return "", err
+	}
+	m.content = append(buf, rest...)
+	return dst, nil
+}
+
+func (m *flakyManager) Ls(p string) ([]unit.File, error) {
+	return nil, m.fail()
+}
+
+func (m *flakyManager) Remove(p string) error {
+	return m.fail()
+}
+
+func (m *flakyManager) Close() error {
+	return nil
+}
+
+func (m *flakyManager) Description() map[string]any {
+	return map[string]any{"name": "flaky", "id": "flaky-volume"}
+}
+
+func newTestRetryManager(mng ManagerAtomic, attempts int) (*RetryManager, *[]time.Duration) {
+	logger.Init("local", io.Discard)
+
+	delays := make([]time.Duration, 0)
+	rm := NewRetryManager(mng, unit.RetryPolicy{
+		Attempts: attempts,
+		Delay:    time.Second,
+		MaxDelay: 3 * time.Second,
+	})
+	rm.sleep = func(d time.Duration) { delays = append(delays, d) }
+	return rm, &delays
+}
+
+func TestRetryWrite(t *testing.T) {
+	mng := &flakyManager{failures: 3, err: errNetwork}
+	rm, delays := newTestRetryManager(mng, 5)
+
+	content := []byte("content of backup")
+	path, retries, err := WriteWithRetries(rm, bytes.NewReader(content), "db.zip", unit.WriteOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if path != "db.zip" || retries != 3 {
+		t.Fatalf("unexpected result of writing: path %s, retries %d", path, retries)
+	}
+
+	if !bytes.Equal(mng.content, content) {
+		t.Fatalf("content was not rewound before repeating, there is %s", mng.content)
+	}
+
+	expected := []time.Duration{time.Second, 2 * time.Second, 3 * time.Second}
+	if len(*delays) != len(expected) {
+		t.Fatalf("expected delays %v, there are %v", expected, *delays)
+	}
+	for i := range expected {
+		if (*delays)[i] != expected[i] {
+			t.Fatalf("expected delays %v, there are %v", expected, *delays)
+		}
+	}
+}
+
+func TestRetryAttemptsExceeded(t *testing.T) {
+	mng := &flakyManager{failures: 10, err: errNetwork}
+	rm, _ := newTestRetryManager(mng, 3)
+
+	if err := rm.Remove("db.zip"); !errors.Is(err, errNetwork) {
+		t.Fatalf("expected error of network, there is %v", err)
+	}
+
+	if mng.calls != 3 {
+		t.Fatalf("expected 3 attempts, there are %d", mng.calls)
+	}
+}
+
+func TestRetryNotRetryableError(t *testing.T) {
+	mng := &flakyManager{failures: 10, err: os.ErrNotExist}
+	rm, _ := newTestRetryManager(mng, 3)
+
+	if _, err := rm.Ls("task"); !os.IsNotExist(err) {
+		t.Fatalf("expected error 'not exist', there is %v", err)
+	}
+
+	if mng.calls != 1 {
+		t.Fatalf("error 'not exist' should not be repeated, there are %d attempts", mng.calls)
+	}
+}
+
+func TestRetryUnseekableContent(t *testing.T) {
+	mng := &flakyManager{failures: 1, err: errNetwork}
+	rm, _ := newTestRetryManager(mng, 3)
+
+	rd := io.MultiReader(bytes.NewReader([]byte("content of backup")))
+	if _, err := rm.Write(rd, "db.zip", unit.WriteOptions{}); !errors.Is(err, errNetwork) {
+		t.Fatalf("expected error of network, there is %v", err)
+	}
+
+	if mng.calls != 1 {
+		t.Fatalf("content which can not be rewound should not be written again, there are %d attempts", mng.calls)
+	}
+}
+
+func TestRetryJitter(t *testing.T) {
+	rm := NewRetryManager(&flakyManager{}, unit.RetryPolicy{
+		Attempts: 3,
+		Delay:    time.Second,
+		Jitter:   0.5,
+	})
+
+	for i := 0; i < 100; i++ {
+		d := rm.backoff(1)
+		if d < time.Second/2 || d > time.Second*3/2 {
+			t.Fatalf("delay %v is out of range of jitter", d)
+		}
+	}
+}
+
+func TestNewManagerWithRetry(t *testing.T) {
+	mng, err := NewManager(unit.ClientConfig{
+		Id:    "local",
+		Type:  LOCAL,
+		Root:  t.TempDir(),
+		Retry: unit.RetryPolicy{Attempts: 3},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rm, ok := mng.(*RetryManager)
+	if !ok {
+		t.Fatalf("expected volume with retry policy, there is %T", mng)
+	}
+
+	if VolumeId(rm) != "local" {
+		t.Fatalf("unexpected id of volume %s", VolumeId(rm))
+	}
+}
+
+func TestVerifyThroughDecorator(t *testing.T) {
+	mng, err := NewManager(unit.ClientConfig{
+		Type:  LOCAL,
+		Root:  t.TempDir(),
+		Retry: unit.RetryPolicy{Attempts: 3},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	content := []byte("content of backup")
+	sum, err := unit.ComputeChecksum(bytes.NewReader(content))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := mng.Write(bytes.NewReader(content), "db.zip", unit.WriteOptions{}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := Verify(mng, "db.zip", sum); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := Verify(&flakyManager{}, "db.zip", sum); !errors.Is(err, ErrUnverifiable) {
+		t.Fatalf("expected error of unsupported verification, there is %v", err)
+	}
+}
+
+func TestFreeSpaceThroughDecorator(t *testing.T) {
+	mng, err := NewManager(unit.ClientConfig{
+		Type:      LOCAL,
+		Root:      filepath.Join(t.TempDir(), "not", "created"),
+		Retry:     unit.RetryPolicy{Attempts: 3},
+		Bandwidth: unit.BandwidthPolicy{Limit: 1024},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if free, err := FreeSpace(mng); err != nil || free <= 0 {
+		t.Fatalf("expected free space of disk, there is %d, %v", free, err)
+	}
+
+	if _, err := FreeSpace(&flakyManager{}); !errors.Is(err, ErrUnknownFreeSpace) {
+		t.Fatalf("expected error of unknown free space, there is %v", err)
+	}
+}
@@ -0,0 +1,241 @@
+package sftp
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	sftpclient "github.com/pkg/sftp"
+	"github.com/vilasle/backilli/pkg/fs"
+	"github.com/vilasle/backilli/pkg/fs/unit"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+const connectTimeout = 30 * time.Second
+
+var ErrAuthMethod = errors.New("does not define password or private key for sftp")
+
+type SftpClient struct {
+	conn   *ssh.Client
+	client *sftpclient.Client
+	host   string
+	id     string
+	root   string
+}
+
+// conf.Password - password of user, it is used when private key is not defined
+// conf.PrivateKey - path to private key of user
+// conf.Passphrase - passphrase of private key if it is encrypted
+// conf.KnownHosts - path to known_hosts file. If it is empty then will use ~/.ssh/known_hosts
+func NewClient(conf unit.ClientConfig) (*SftpClient, error) {
+	auth, err := authMethods(conf)
+	if err != nil {
+		return nil, err
+	}
+
+	hostKeyCallback, err := hostKeyCallback(conf.KnownHosts)
+	if err != nil {
+		return nil, err
+	}
+
+	address := net.JoinHostPort(conf.Host, strconv.Itoa(conf.Port))
+	conn, err := ssh.Dial("tcp", address, &ssh.ClientConfig{
+		User:            conf.User,
+		Auth:            auth,
+		HostKeyCallback: hostKeyCallback,
+		Timeout:         connectTimeout,
+	})
+	if err != nil {
+		return nil, errors.Join(err, fmt.Errorf("could not connect to %s", address))
+	}
+
+	client, err := sftpclient.NewClient(conn)
+	if err != nil {
+		conn.Close()
+		return nil, errors.Join(err, fmt.Errorf("could not start sftp session on %s", address))
+	}
+
+	return &SftpClient{
+		conn:   conn,
+		client: client,
+		host:   address,
+		id:     conf.Id,
+		root:   conf.Root,
+	}, nil
+}
+
+// Read accepts path which was returned by Write or path relative to root
+func (c SftpClient) Read(path string) ([]byte, error) {
+	fd, err := c.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer fd.Close()
+
+	var buffer bytes.Buffer
+	if _, err := io.Copy(&buffer, fd); err != nil {
+		return nil, err
+	}
+	return buffer.Bytes(), nil
+}
+
+func (c SftpClient) Open(path string) (io.ReadCloser, error) {
+	if !fs.InRoot(c.root, path) {
+		path = c.fullPath(path)
+	}
+	return c.client.Open(path)
+}
+
+func (c SftpClient) Write(rd io.Reader, dst string, opt unit.WriteOptions) (string, error) {
+	fpf := c.fullPath(dst)
+
+	if err := c.client.MkdirAll(path.Dir(fpf)); err != nil {
+		return "", err
+	}
+
+	// file is written under temporary name, so failed uploading does not look like backup
+	tmp := fs.PartialName(fpf)
+	if err := c.writeFile(tmp, rd); err != nil {
+		c.client.Remove(tmp)
+		return "", err
+	}
+
+	if err := c.client.PosixRename(tmp, fpf); err != nil {
+		c.client.Remove(tmp)
+		return "", err
+	}
+	return fpf, nil
+}
+
+// writeFile returns error of closing, because server reports failed flushing and exceeded quota there
+func (c SftpClient) writeFile(path string, rd io.Reader) error {
+	wd, err := c.client.Create(path)
+	if err != nil {
+		return err
+	}
+
+	if _, err := wd.ReadFrom(rd); err != nil {
+		wd.Close()
+		return err
+	}
+	return wd.Close()
+}
+
+// Verify compares file which was written by Write with checksum of source
+func (c SftpClient) Verify(dst string, sum unit.Checksum) error {
+	fd, err := c.client.Open(c.fullPath(dst))
+	if err != nil {
+		return err
+	}
+	defer fd.Close()
+
+	return sum.Compare(fd)
+}
+
+func (c SftpClient) Ls(path string) ([]unit.File, error) {
+	dir := c.fullPath(path)
+	stat, err := c.client.Stat(dir)
+	if err != nil {
+		return nil, err
+	}
+	if !stat.IsDir() {
+		return nil, fmt.Errorf("file is not a directory")
+	}
+
+	ls, err := c.client.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	res := make([]unit.File, 0, len(ls))
+	for _, f := range ls {
+		if fs.IsPartial(f.Name()) {
+			continue
+		}
+		res = append(res, unit.NewFile(f.Name(), f.ModTime()))
+	}
+	return res, nil
+}
+
+func (c SftpClient) Remove(path string) error {
+	rp := c.fullPath(path)
+	if _, err := c.client.Stat(rp); err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+	return c.client.RemoveAll(rp)
+}
+
+func (c SftpClient) Close() error {
+	return errors.Join(c.client.Close(), c.conn.Close())
+}
+
+func (c SftpClient) Description() map[string]any {
+	res := make(map[string]any)
+	res["name"] = "sftp"
+	res["id"] = c.id
+	res["host"] = c.host
+	res["root"] = c.root
+	return res
+}
+
+func (c SftpClient) fullPath(p string) string {
+	return path.Join(c.root, filepath.ToSlash(p))
+}
+
+func authMethods(conf unit.ClientConfig) ([]ssh.AuthMethod, error) {
+	auth := make([]ssh.AuthMethod, 0, 2)
+
+	if conf.PrivateKey != "" {
+		key, err := os.ReadFile(conf.PrivateKey)
+		if err != nil {
+			return nil, errors.Join(err, fmt.Errorf("could not read private key %s", conf.PrivateKey))
+		}
+
+		var signer ssh.Signer
+		if conf.Passphrase != "" {
+			signer, err = ssh.ParsePrivateKeyWithPassphrase(key, []byte(conf.Passphrase))
+		} else {
+			signer, err = ssh.ParsePrivateKey(key)
+		}
+		if err != nil {
+			return nil, errors.Join(err, fmt.Errorf("could not parse private key %s", conf.PrivateKey))
+		}
+		auth = append(auth, ssh.PublicKeys(signer))
+	}
+
+	if conf.Password != "" {
+		auth = append(auth, ssh.Password(conf.Password))
+	}
+
+	if len(auth) == 0 {
+		return nil, ErrAuthMethod
+	}
+	return auth, nil
+}
+
+func hostKeyCallback(knownHosts string) (ssh.HostKeyCallback, error) {
+	if knownHosts == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return nil, errors.Join(err, fmt.Errorf("could not define path to known_hosts"))
+		}
+		knownHosts = filepath.Join(home, ".ssh", "known_hosts")
+	}
+
+	callback, err := knownhosts.New(knownHosts)
+	if err != nil {
+		return nil, errors.Join(err, fmt.Errorf("could not load known hosts from %s", knownHosts))
+	}
+	return callback, nil
+}
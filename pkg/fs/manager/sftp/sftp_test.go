@@ -0,0 +1,417 @@
+package sftp
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/pem"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"testing/iotest"
+
+	sftpclient "github.com/pkg/sftp"
+	"github.com/vilasle/backilli/pkg/fs/manager/conformance"
+	"github.com/vilasle/backilli/pkg/fs/unit"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+const (
+	testUser     = "backup"
+	testPassword = "secret"
+)
+
+type testServer struct {
+	listener   net.Listener
+	config     *ssh.ServerConfig
+	hostKey    ssh.Signer
+	knownHosts string
+	host       string
+	port       int
+}
+
+// newTestServer starts ssh server which serves sftp subsystem on local filesystem
+// and accepts password of testUser or clientKey
+func newTestServer(t *testing.T, clientKey ssh.PublicKey) *testServer {
+	_, hostPriv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hostKey, err := ssh.NewSignerFromKey(hostPriv)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	config := &ssh.ServerConfig{
+		PasswordCallback: func(c ssh.ConnMetadata, pass []byte) (*ssh.Permissions, error) {
+			if c.User() == testUser && string(pass) == testPassword {
+				return nil, nil
+			}
+			return nil, errors.New("access denied")
+		},
+		PublicKeyCallback: func(c ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+			if clientKey != nil && bytes.Equal(key.Marshal(), clientKey.Marshal()) {
+				return nil, nil
+			}
+			return nil, errors.New("access denied")
+		},
+	}
+	config.AddHostKey(hostKey)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := listener.Addr().(*net.TCPAddr)
+
+	srv := &testServer{
+		listener: listener,
+		config:   config,
+		hostKey:  hostKey,
+		host:     addr.IP.String(),
+		port:     addr.Port,
+	}
+	srv.knownHosts = srv.writeKnownHosts(t, hostKey.PublicKey())
+
+	go srv.serve()
+	t.Cleanup(func() { listener.Close() })
+
+	return srv
+}
+
+func (s *testServer) writeKnownHosts(t *testing.T, key ssh.PublicKey) string {
+	path := filepath.Join(t.TempDir(), "known_hosts")
+	line := knownhosts.Line([]string{s.listener.Addr().String()}, key)
+	if err := os.WriteFile(path, []byte(line+"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func (s *testServer) serve() {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		go s.handle(conn)
+	}
+}
+
+func (s *testServer) handle(conn net.Conn) {
+	_, chans, reqs, err := ssh.NewServerConn(conn, s.config)
+	if err != nil {
+		conn.Close()
+		return
+	}
+	go ssh.DiscardRequests(reqs)
+
+	for newChannel := range chans {
+		if newChannel.ChannelType() != "session" {
+			newChannel.Reject(ssh.UnknownChannelType, "unknown channel type")
+			continue
+		}
+		channel, requests, err := newChannel.Accept()
+		if err != nil {
+			continue
+		}
+
+		go func(in <-chan *ssh.Request) {
+			for req := range in {
+				ok := req.Type == "subsystem" && string(req.Payload[4:]) == "sftp"
+				req.Reply(ok, nil)
+			}
+		}(requests)
+
+		go func() {
+			defer channel.Close()
+			server, err := sftpclient.NewServer(channel)
+			if err != nil {
+				return
+			}
+			server.Serve()
+		}()
+	}
+}
+
+func (s *testServer) clientConfig(root string) unit.ClientConfig {
+	return unit.ClientConfig{
+		Host:       s.host,
+		Port:       s.port,
+		User:       testUser,
+		Password:   testPassword,
+		KnownHosts: s.knownHosts,
+		Root:       root,
+	}
+}
+
+func TestWrite(t *testing.T) {
+	srv := newTestServer(t, nil)
+	root := t.TempDir()
+
+	client, err := NewClient(srv.clientConfig(root))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	testSet := getTestSet()
+	path, err := client.Write(bytes.NewBuffer(testSet), filepath.Join("task", "01-01-2023", "test.txt"), unit.WriteOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cnt, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(cnt, testSet) {
+		t.Fatal("content of file does not match with test sets")
+	}
+}
+
+func TestInterruptedWrite(t *testing.T) {
+	srv := newTestServer(t, nil)
+	root := t.TempDir()
+
+	client, err := NewClient(srv.clientConfig(root))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	testSet := getTestSet()
+	if _, err := client.Write(bytes.NewReader(testSet), filepath.Join("task", "db.zip"), unit.WriteOptions{}); err != nil {
+		t.Fatal(err)
+	}
+
+	errBroken := errors.New("source is broken")
+	rd := io.MultiReader(bytes.NewReader(testSet[:100]), iotest.ErrReader(errBroken))
+	if _, err := client.Write(rd, filepath.Join("task", "db.zip"), unit.WriteOptions{}); !errors.Is(err, errBroken) {
+		t.Fatalf("expected error of source, there is %v", err)
+	}
+
+	content, err := os.ReadFile(filepath.Join(root, "task", "db.zip"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(content, testSet) {
+		t.Fatal("previous file was overwritten by interrupted writing")
+	}
+
+	// file which is left by broken connection is not listed
+	if err := os.WriteFile(filepath.Join(root, "task", "db2.zip.partial"), testSet[:100], os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	ls, err := client.Ls("task")
+	if err != nil || len(ls) != 1 || ls[0].Name != "db.zip" {
+		t.Fatalf("expected db.zip only, there are %v, %v", ls, err)
+	}
+}
+
+func TestVerify(t *testing.T) {
+	srv := newTestServer(t, nil)
+	root := t.TempDir()
+
+	client, err := NewClient(srv.clientConfig(root))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	testSet := getTestSet()
+	sum, err := unit.ComputeChecksum(bytes.NewReader(testSet))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	path, err := client.Write(bytes.NewReader(testSet), "db.zip", unit.WriteOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := client.Verify("db.zip", sum); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(path, testSet[1:], 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.Verify("db.zip", sum); !errors.Is(err, unit.ErrChecksumMismatch) {
+		t.Fatalf("expected error of checksum mismatch, there is %v", err)
+	}
+}
+
+func TestRead(t *testing.T) {
+	srv := newTestServer(t, nil)
+	root := t.TempDir()
+
+	testSet := getTestSet()
+	path := filepath.Join(root, "test.txt")
+	if err := os.WriteFile(path, testSet, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	client, err := NewClient(srv.clientConfig(root))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	res, err := client.Read(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(res, testSet) {
+		t.Fatal("content of file does not match with test sets")
+	}
+}
+
+func TestLs(t *testing.T) {
+	srv := newTestServer(t, nil)
+	root := t.TempDir()
+
+	for _, d := range []string{"01-01-2023", "02-01-2023"} {
+		if err := os.MkdirAll(filepath.Join(root, "task", d), os.ModePerm); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	client, err := NewClient(srv.clientConfig(root))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	ls, err := client.Ls("task")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	names := make([]string, 0, len(ls))
+	for _, f := range ls {
+		names = append(names, f.Name)
+	}
+	sort.Strings(names)
+
+	if strings.Join(names, ",") != "01-01-2023,02-01-2023" {
+		t.Fatalf("unexpected list of files %v", names)
+	}
+
+	if _, err := client.Ls("missing"); !os.IsNotExist(err) {
+		t.Fatalf("expected error 'not exist', there is %v", err)
+	}
+}
+
+func TestRemove(t *testing.T) {
+	srv := newTestServer(t, nil)
+	root := t.TempDir()
+
+	dir := filepath.Join(root, "task", "01-01-2023", "db")
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "db.zip"), getTestSet(), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	client, err := NewClient(srv.clientConfig(root))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	if err := client.Remove("task/01-01-2023"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := os.Stat(filepath.Join(root, "task", "01-01-2023")); !os.IsNotExist(err) {
+		t.Fatal("directory is exist but should be removed")
+	}
+}
+
+func TestPrivateKeyAuth(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sshPub, err := ssh.NewPublicKey(pub)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	block, err := ssh.MarshalPrivateKey(priv, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyPath := filepath.Join(t.TempDir(), "id_ed25519")
+	if err := os.WriteFile(keyPath, pem.EncodeToMemory(block), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	srv := newTestServer(t, sshPub)
+	conf := srv.clientConfig(t.TempDir())
+	conf.Password = ""
+	conf.PrivateKey = keyPath
+
+	client, err := NewClient(conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.Close()
+}
+
+func TestUnknownHostKey(t *testing.T) {
+	srv := newTestServer(t, nil)
+
+	_, otherPriv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := ssh.NewSignerFromKey(otherPriv)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	conf := srv.clientConfig(t.TempDir())
+	conf.KnownHosts = srv.writeKnownHosts(t, other.PublicKey())
+
+	if _, err := NewClient(conf); err == nil {
+		t.Fatal("expected error of host key verification")
+	}
+}
+
+func getTestSet() []byte {
+	n := 2048
+	p := "AaBbCcDdEeFfGgHhIiJjKkLlMmNnOoPpQqRrSsTtUuVvWwXxYyZz"
+	tp := make([]byte, len(p))
+	for i := 0; i < len(p); i++ {
+		tp[i] = p[i]
+	}
+
+	testSet := make([]byte, 0)
+	for i := 0; i < n; i++ {
+		testSet = append(testSet, tp...)
+	}
+
+	return testSet
+}
+
+func TestConformance(t *testing.T) {
+	conformance.Run(t, func(t *testing.T) conformance.Volume {
+		srv := newTestServer(t, nil)
+		client, err := NewClient(srv.clientConfig(t.TempDir()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { client.Close() })
+		return client
+	})
+}
@@ -1,107 +1,139 @@
 package smb
 
 import (
-	"bytes"
+	"errors"
 	"fmt"
 	"io"
 	"net"
 	"os"
+	"strconv"
+	"sync"
+	"time"
 
 	smb2 "github.com/hirochachacha/go-smb2"
 	"github.com/vilasle/backilli/pkg/fs"
 	"github.com/vilasle/backilli/pkg/fs/unit"
 )
 
+const connectTimeout = 30 * time.Second
+
+// NTSTATUS codes which mean that server dropped session and client has to dial again
+var sessionLost = map[uint32]bool{
+	0xC00000C9: true, // STATUS_NETWORK_NAME_DELETED
+	0xC0000203: true, // STATUS_USER_SESSION_DELETED
+	0xC000020C: true, // STATUS_CONNECTION_DISCONNECTED
+	0xC000035C: true, // STATUS_NETWORK_SESSION_EXPIRED
+}
+
+// SmbClient re-dials server and re-mounts share when session drops.
+// Operation which found broken session fails, the next one opens new session
 type SmbClient struct {
-	mountPoint *smb2.Share
+	mx         *sync.Mutex
+	dialer     *smb2.Dialer
+	address    string
+	share      string
+	conn       net.Conn
 	session    *smb2.Session
+	mountPoint *smb2.Share
+	id         string
 	root       string
 }
 
 func NewClient(conf unit.ClientConfig) (*SmbClient, error) {
-	conn, err := net.Dial("tcp", fmt.Sprintf("%s:%d", conf.Host, conf.Port))
-	if err != nil {
-		return nil, err
-	}
-
-	d := &smb2.Dialer{
-		Initiator: &smb2.NTLMInitiator{
-			User:     conf.User,
-			Password: conf.Password,
-			Domain:   conf.Domain,
+	c := &SmbClient{
+		mx: &sync.Mutex{},
+		dialer: &smb2.Dialer{
+			Initiator: &smb2.NTLMInitiator{
+				User:     conf.User,
+				Password: conf.Password,
+				Domain:   conf.Domain,
+			},
 		},
+		address: net.JoinHostPort(conf.Host, strconv.Itoa(conf.Port)),
+		share:   conf.MountPoint,
+		id:      conf.Id,
+		root:    conf.Root,
 	}
 
-	s, err := d.Dial(conn)
-	if err != nil {
+	if _, err := c.mount(); err != nil {
 		return nil, err
 	}
+	return c, nil
+}
 
-	share, err := s.Mount(conf.MountPoint)
+// Read accepts path which was returned by Write or path relative to root
+func (c *SmbClient) Read(path string) ([]byte, error) {
+	rc, err := c.Open(path)
 	if err != nil {
 		return nil, err
 	}
-
-	c := SmbClient{
-		mountPoint: share,
-		session:    s,
-		root:       conf.Root,
-	}
-	return &c, nil
+	defer rc.Close()
+	return io.ReadAll(rc)
 }
 
-func (c SmbClient) Read(path string) ([]byte, error) {
-	fd, err := c.mountPoint.Open(path)
+func (c *SmbClient) Open(path string) (_ io.ReadCloser, err error) {
+	share, err := c.mount()
 	if err != nil {
 		return nil, err
 	}
-	defer fd.Close()
 
-	stat, err := fd.Stat()
+	if c.root != "" && !fs.InRoot(c.root, path) {
+		path = fs.GetFullPath(string(smb2.PathSeparator), c.root, path)
+	}
+	fd, err := share.Open(path)
 	if err != nil {
-		return nil, err
+		return nil, c.release(share, err)
 	}
-	res := make([]byte, stat.Size())
-	buffer := make([]byte, 2048)
-
-	offs := 0
-	for {
-		n, err := fd.Read(buffer)
-
-		if err == io.EOF {
-			break
-		}
+	return &smbReader{File: fd, share: share, c: c}, nil
+}
 
-		if err != nil {
-			return nil, err
-		}
-		for i := 0; i < n; i++ {
-			res[(offs + i)] = buffer[i]
-		}
-		offs += len(buffer)
+func (c *SmbClient) Write(rd io.Reader, dst string, opt unit.WriteOptions) (_ string, err error) {
+	share, err := c.mount()
+	if err != nil {
+		return "", err
 	}
-	return res, nil
-}
+	defer func() { err = c.release(share, err) }()
 
-func (c SmbClient) Write(rd *bytes.Buffer, dst string) (string, error) {
 	fpf := fs.GetFullPath(string(smb2.PathSeparator), c.root, dst)
 	fpd := fs.Dir(fpf)
-	
-	_, err := c.mountPoint.Stat(fpd)
+
+	_, err = share.Stat(fpd)
 	if err != nil {
 		if os.IsNotExist(err) {
-			if err := c.mkdirAll(fpd); err != nil {
+			if err := share.MkdirAll(fpd, os.ModeDir); err != nil {
 				return "", err
 			}
-		}else {
+		} else {
 			return "", err
 		}
 	}
 
-	wd, err := c.createFile(fpf)
-	if err != nil {
+	// file is written under temporary name, so interrupted writing does not look like backup
+	tmp := fs.PartialName(fpf)
+	if err := writeFile(share, tmp, rd); err != nil {
+		share.Remove(tmp)
 		return "", err
 	}
+
+	// renaming over existing file is not allowed by SMB
+	if _, err := share.Stat(fpf); err == nil {
+		if err := share.Remove(fpf); err != nil {
+			share.Remove(tmp)
+			return "", err
+		}
+	}
+	if err := share.Rename(tmp, fpf); err != nil {
+		share.Remove(tmp)
+		return "", err
+	}
+	return fpf, nil
+}
+
+func writeFile(share *smb2.Share, path string, rd io.Reader) error {
+	wd, err := createFile(share, path)
+	if err != nil {
+		return err
+	}
 	defer wd.Close()
 
 	var bufferOffset int64 = 1024 * 64
@@ -109,27 +141,47 @@ func (c SmbClient) Write(rd *bytes.Buffer, dst string) (string, error) {
 
 	for {
 		n, err := rd.Read(buf)
+		if n > 0 {
+			if _, err := wd.Write(buf[:n]); err != nil {
+				return err
+			}
+		}
 		if err != nil {
 			if err == io.EOF {
 				break
 			}
-			return "", err
+			return err
 		}
+	}
+	return wd.Close()
+}
 
-		if n > 0 {
-			if _, err := wd.Write(buf); err != nil {
-				return "", err
-			}
-			continue
-		}
-		break
+// Verify compares file which was written by Write with checksum of source
+func (c *SmbClient) Verify(dst string, sum unit.Checksum) (err error) {
+	share, err := c.mount()
+	if err != nil {
+		return err
 	}
-	return fpf, err
+	defer func() { err = c.release(share, err) }()
+
+	fd, err := share.Open(fs.GetFullPath(string(smb2.PathSeparator), c.root, dst))
+	if err != nil {
+		return err
+	}
+	defer fd.Close()
+
+	return sum.Compare(fd)
 }
 
-func (c SmbClient) Ls(path string) ([]unit.File, error) {
+func (c *SmbClient) Ls(path string) (_ []unit.File, err error) {
+	share, err := c.mount()
+	if err != nil {
+		return nil, err
+	}
+	defer func() { err = c.release(share, err) }()
+
 	fl := fs.GetFullPath("\\", c.root, path)
-	stat, err := c.mountPoint.Stat(fl)
+	stat, err := share.Stat(fl)
 	if err != nil {
 		return nil, err
 	}
@@ -137,31 +189,139 @@ func (c SmbClient) Ls(path string) ([]unit.File, error) {
 		return nil, fmt.Errorf("file is not a directory")
 	}
 
-	ls, err := c.mountPoint.ReadDir(fl)
+	ls, err := share.ReadDir(fl)
 	if err != nil {
 		return nil, err
 	}
-	res := make([]unit.File, len(ls))
-	for i, f := range ls {
-		res[i] = unit.File{
+	res := make([]unit.File, 0, len(ls))
+	for _, f := range ls {
+		if fs.IsPartial(f.Name()) {
+			continue
+		}
+		res = append(res, unit.File{
 			Name: f.Name(),
 			Date: f.ModTime(),
-		}
+		})
 	}
 	return res, nil
 }
 
-func (c SmbClient) Remove(path string) error {
+// FreeSpace returns space of share which is available for user
+func (c *SmbClient) FreeSpace() (_ int64, err error) {
+	share, err := c.mount()
+	if err != nil {
+		return 0, err
+	}
+	defer func() { err = c.release(share, err) }()
+
+	info, err := share.Statfs("")
+	if err != nil {
+		return 0, err
+	}
+	return int64(info.AvailableBlockCount() * info.FragmentSize() * info.BlockSize()), nil
+}
+
+func (c *SmbClient) Remove(path string) error {
+	share, err := c.mount()
+	if err != nil {
+		return err
+	}
+
 	rp := fs.GetFullPath("\\", c.root, path)
-	return c.mountPoint.RemoveAll(rp)
+	return c.release(share, share.RemoveAll(rp))
 }
 
-func (c SmbClient) Close() error {
-	return c.session.Logoff()
+func (c *SmbClient) Close() error {
+	c.mx.Lock()
+	defer c.mx.Unlock()
+
+	if c.session == nil {
+		return nil
+	}
+	err := c.session.Logoff()
+	c.conn.Close()
+	c.conn, c.session, c.mountPoint = nil, nil, nil
+	return err
 }
 
-func (c SmbClient) createFile(path string) (*unit.File, error) {
-	fd, err := c.mountPoint.Create(path)
+// mount returns mounted share and opens new session if previous one was dropped
+func (c *SmbClient) mount() (*smb2.Share, error) {
+	c.mx.Lock()
+	defer c.mx.Unlock()
+
+	if c.mountPoint != nil {
+		return c.mountPoint, nil
+	}
+
+	conn, err := net.DialTimeout("tcp", c.address, connectTimeout)
+	if err != nil {
+		return nil, errors.Join(err, fmt.Errorf("could not connect to %s", c.address))
+	}
+
+	s, err := c.dialer.Dial(conn)
+	if err != nil {
+		conn.Close()
+		return nil, errors.Join(err, fmt.Errorf("could not open session on %s", c.address))
+	}
+
+	share, err := s.Mount(c.share)
+	if err != nil {
+		s.Logoff()
+		conn.Close()
+		return nil, errors.Join(err, fmt.Errorf("could not mount %s", c.share))
+	}
+
+	c.conn, c.session, c.mountPoint = conn, s, share
+	return share, nil
+}
+
+// release closes session if error of operation shows that session is broken
+func (c *SmbClient) release(share *smb2.Share, err error) error {
+	if err == nil || !isSessionLost(err) {
+		return err
+	}
+
+	c.mx.Lock()
+	defer c.mx.Unlock()
+
+	// other operation could reconnect already
+	if c.mountPoint == share {
+		c.conn.Close()
+		c.conn, c.session, c.mountPoint = nil, nil, nil
+	}
+	return err
+}
+
+// smbReader closes session if reading of file shows that session is broken
+type smbReader struct {
+	*smb2.File
+	share *smb2.Share
+	c     *SmbClient
+}
+
+func (r *smbReader) Read(p []byte) (int, error) {
+	n, err := r.File.Read(p)
+	return n, r.c.release(r.share, err)
+}
+
+func isSessionLost(err error) bool {
+	var (
+		terr *smb2.TransportError
+		rerr *smb2.ResponseError
+		nerr net.Error
+	)
+	switch {
+	case errors.As(err, &terr), errors.As(err, &nerr):
+		return true
+	case errors.As(err, &rerr):
+		return sessionLost[rerr.Code]
+	default:
+		return errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, net.ErrClosed)
+	}
+}
+
+func createFile(share *smb2.Share, path string) (*unit.File, error) {
+	fd, err := share.Create(path)
 	if err != nil {
 		return nil, err
 	}
@@ -177,14 +337,12 @@ func (c SmbClient) createFile(path string) (*unit.File, error) {
 	}, nil
 }
 
-func (c SmbClient) mkdirAll(path string) error {
-	return c.mountPoint.MkdirAll(path, os.ModeDir)
-}
-
-func (c SmbClient) Description() map[string]any {
+func (c *SmbClient) Description() map[string]any {
 	res := make(map[string]any)
 	res["name"] = "smb"
+	res["id"] = c.id
+	res["host"] = c.address
 	res["root"] = c.root
-	res["mountPoint"] = c.mountPoint
+	res["mountPoint"] = c.share
 	return res
 }
\ No newline at end of file
@@ -0,0 +1,133 @@
+package manager
+
+import (
+	"io"
+	"sync"
+	"time"
+
+	"github.com/vilasle/backilli/pkg/fs/unit"
+)
+
+// throttleChunk - maximum of bytes which are passed without waiting, it keeps transfer smooth
+const throttleChunk = 32 * 1024
+
+// ThrottleManager limits speed of transfers of volume. All concurrent transfers share one limit
+type ThrottleManager struct {
+	mng     ManagerAtomic
+	policy  unit.BandwidthPolicy
+	limiter *limiter
+}
+
+func NewThrottleManager(mng ManagerAtomic, policy unit.BandwidthPolicy) *ThrottleManager {
+	return &ThrottleManager{
+		mng:     mng,
+		policy:  policy,
+		limiter: &limiter{now: time.Now, sleep: time.Sleep},
+	}
+}
+
+func (m *ThrottleManager) Read(p string) ([]byte, error) {
+	rc, err := m.Open(p)
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	return io.ReadAll(rc)
+}
+
+func (m *ThrottleManager) Open(p string) (io.ReadCloser, error) {
+	rc, err := m.mng.Open(p)
+	if err != nil {
+		return nil, err
+	}
+	return throttledReadCloser{Reader: &throttledReader{rd: rc, m: m}, Closer: rc}, nil
+}
+
+func (m *ThrottleManager) Write(rd io.Reader, dst string, opt unit.WriteOptions) (string, error) {
+	return m.mng.Write(&throttledReader{rd: rd, m: m}, dst, opt)
+}
+
+func (m *ThrottleManager) Ls(p string) ([]unit.File, error) {
+	return m.mng.Ls(p)
+}
+
+func (m *ThrottleManager) Remove(p string) error {
+	return m.mng.Remove(p)
+}
+
+func (m *ThrottleManager) Close() error {
+	return m.mng.Close()
+}
+
+func (m *ThrottleManager) Description() map[string]any {
+	return m.mng.Description()
+}
+
+// Unwrap returns volume which transfers are limited
+func (m *ThrottleManager) Unwrap() ManagerAtomic {
+	return m.mng
+}
+
+func (m *ThrottleManager) wait(n int) {
+	m.limiter.wait(n, m.policy.LimitAt(m.limiter.now()))
+}
+
+type throttledReader struct {
+	rd io.Reader
+	m  *ThrottleManager
+}
+
+func (r *throttledReader) Read(p []byte) (int, error) {
+	if len(p) > throttleChunk {
+		p = p[:throttleChunk]
+	}
+	n, err := r.rd.Read(p)
+	r.m.wait(n)
+	return n, err
+}
+
+type throttledReadCloser struct {
+	io.Reader
+	io.Closer
+}
+
+// limiter spreads transfer of bytes in time, so speed is not greater than limit
+type limiter struct {
+	mx    sync.Mutex
+	start time.Time
+	sent  int64
+	limit int64
+	now   func() time.Time
+	sleep func(time.Duration)
+}
+
+// wait reserves time for transfer of n bytes and waits till reserved time comes
+func (l *limiter) wait(n int, limit int64) {
+	if n <= 0 || limit <= 0 {
+		return
+	}
+
+	l.mx.Lock()
+	now := l.now()
+	next := l.next()
+	if next.Before(now) {
+		// limiter was idle, previous transfers do not give credit
+		l.start, l.sent, l.limit = now, 0, limit
+	} else if limit != l.limit {
+		// limit was changed by schedule, reserved time is kept
+		l.start, l.sent, l.limit = next, 0, limit
+	}
+	l.sent += int64(n)
+	delay := l.next().Sub(now)
+	l.mx.Unlock()
+
+	l.sleep(delay)
+}
+
+// next is time when all sent bytes are transferred
+func (l *limiter) next() time.Time {
+	if l.limit <= 0 {
+		return l.start
+	}
+	return l.start.Add(time.Duration(l.sent * int64(time.Second) / l.limit))
+}
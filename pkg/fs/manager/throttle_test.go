@@ -0,0 +1,149 @@
+package manager
+
+import (
+	"bytes"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/vilasle/backilli/pkg/fs/unit"
+)
+
+// fakeClock moves time forward only by sleeping
+type fakeClock struct {
+	t     time.Time
+	slept time.Duration
+}
+
+func (c *fakeClock) now() time.Time {
+	return c.t
+}
+
+func (c *fakeClock) sleep(d time.Duration) {
+	c.t = c.t.Add(d)
+	c.slept += d
+}
+
+func newTestThrottleManager(mng ManagerAtomic, policy unit.BandwidthPolicy, start time.Time) (*ThrottleManager, *fakeClock) {
+	clock := &fakeClock{t: start}
+	tm := NewThrottleManager(mng, policy)
+	tm.limiter.now = clock.now
+	tm.limiter.sleep = clock.sleep
+	return tm, clock
+}
+
+func TestThrottleWrite(t *testing.T) {
+	mng := &flakyManager{}
+	start := time.Date(2023, 1, 1, 12, 0, 0, 0, time.Local)
+	tm, clock := newTestThrottleManager(mng, unit.BandwidthPolicy{Limit: 100 * 1024}, start)
+
+	content := bytes.Repeat([]byte("a"), 500*1024)
+	if _, err := tm.Write(bytes.NewReader(content), "db.zip", unit.WriteOptions{}); err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(mng.content, content) {
+		t.Fatal("content was changed by throttling")
+	}
+
+	if clock.slept != 5*time.Second {
+		t.Fatalf("expected 5s of transfer, there is %v", clock.slept)
+	}
+}
+
+func TestThrottleOpen(t *testing.T) {
+	content := bytes.Repeat([]byte("a"), 300*1024)
+	mng := &flakyManager{content: content}
+	start := time.Date(2023, 1, 1, 12, 0, 0, 0, time.Local)
+	tm, clock := newTestThrottleManager(mng, unit.BandwidthPolicy{Limit: 100 * 1024}, start)
+
+	rc, err := tm.Open("db.zip")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rc.Close()
+
+	res, err := io.ReadAll(rc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(res, content) {
+		t.Fatal("content was changed by throttling")
+	}
+
+	if clock.slept != 3*time.Second {
+		t.Fatalf("expected 3s of transfer, there is %v", clock.slept)
+	}
+}
+
+func TestThrottleSchedule(t *testing.T) {
+	policy := unit.BandwidthPolicy{
+		Limit: 1024,
+		Schedule: []unit.BandwidthWindow{
+			{From: 18 * time.Hour, To: 2 * time.Hour, Limit: 256},
+			{From: 9 * time.Hour, To: 10 * time.Hour, Limit: 0},
+		},
+	}
+
+	cases := []struct {
+		hour  int
+		limit int64
+	}{
+		{12, 1024},
+		{19, 256},
+		{1, 256},
+		{2, 1024},
+		{9, 0},
+	}
+	for _, c := range cases {
+		at := time.Date(2023, 1, 1, c.hour, 30, 0, 0, time.Local)
+		if limit := policy.LimitAt(at); limit != c.limit {
+			t.Fatalf("expected limit %d at %v, there is %d", c.limit, at, limit)
+		}
+	}
+
+	// unlimited window does not wait
+	mng := &flakyManager{}
+	tm, clock := newTestThrottleManager(mng, policy, time.Date(2023, 1, 1, 9, 30, 0, 0, time.Local))
+	if _, err := tm.Write(bytes.NewReader(make([]byte, 4096)), "db.zip", unit.WriteOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if clock.slept != 0 {
+		t.Fatalf("transfer in unlimited window should not wait, there is %v", clock.slept)
+	}
+}
+
+func TestThrottleSharedLimit(t *testing.T) {
+	start := time.Date(2023, 1, 1, 12, 0, 0, 0, time.Local)
+	tm, clock := newTestThrottleManager(&flakyManager{}, unit.BandwidthPolicy{Limit: 1024}, start)
+
+	// two transfers of the same volume share limit
+	first := &throttledReader{rd: bytes.NewReader(make([]byte, 1024)), m: tm}
+	second := &throttledReader{rd: bytes.NewReader(make([]byte, 1024)), m: tm}
+	io.ReadAll(first)
+	io.ReadAll(second)
+
+	if clock.slept != 2*time.Second {
+		t.Fatalf("expected 2s of transfers, there is %v", clock.slept)
+	}
+}
+
+func TestNewManagerWithThrottle(t *testing.T) {
+	mng, err := NewManager(unit.ClientConfig{
+		Type:      LOCAL,
+		Root:      t.TempDir(),
+		Retry:     unit.RetryPolicy{Attempts: 3},
+		Bandwidth: unit.BandwidthPolicy{Limit: 1024 * 1024},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rm, ok := mng.(*RetryManager)
+	if !ok {
+		t.Fatalf("expected retrying as outer decorator, there is %T", mng)
+	}
+	if _, ok := rm.Unwrap().(*ThrottleManager); !ok {
+		t.Fatalf("expected throttling under retrying, there is %T", rm.Unwrap())
+	}
+}
@@ -0,0 +1,281 @@
+package webdav
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	iofs "io/fs"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/vilasle/backilli/pkg/fs"
+	"github.com/vilasle/backilli/pkg/fs/unit"
+)
+
+var propfindBody = []byte(`<?xml version="1.0" encoding="utf-8"?>` +
+	`<d:propfind xmlns:d="DAV:"><d:prop><d:resourcetype/><d:getlastmodified/></d:prop></d:propfind>`)
+
+type multistatus struct {
+	Responses []response `xml:"response"`
+}
+
+type response struct {
+	Href     string `xml:"href"`
+	Propstat []struct {
+		Prop struct {
+			LastModified string `xml:"getlastmodified"`
+		} `xml:"prop"`
+	} `xml:"propstat"`
+}
+
+// WebdavClient works with WebDAV servers (Nextcloud, ownCloud, Yandex Disk and etc.)
+type WebdavClient struct {
+	client   *http.Client
+	endpoint *url.URL
+	user     string
+	password string
+	id       string
+	root     string
+}
+
+// conf.Endpoint - URL of WebDAV root, for example https://cloud.example.com/remote.php/dav/files/user
+// conf.InsecureSkipVerify - does not verify TLS certificate of server
+func NewClient(conf unit.ClientConfig) (*WebdavClient, error) {
+	endpoint, err := url.Parse(conf.Endpoint)
+	if err != nil {
+		return nil, errors.Join(err, fmt.Errorf("could not parse endpoint of webdav %s", conf.Endpoint))
+	}
+	if endpoint.Scheme != "http" && endpoint.Scheme != "https" {
+		return nil, fmt.Errorf("unexpected endpoint of webdav '%s'", conf.Endpoint)
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if conf.InsecureSkipVerify {
+		transport.TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
+	}
+
+	return &WebdavClient{
+		client:   &http.Client{Transport: transport},
+		endpoint: endpoint,
+		user:     conf.User,
+		password: conf.Password,
+		id:       conf.Id,
+		root:     conf.Root,
+	}, nil
+}
+
+// Read accepts path which was returned by Write or path relative to root
+func (c WebdavClient) Read(p string) ([]byte, error) {
+	rc, err := c.Open(p)
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	return io.ReadAll(rc)
+}
+
+func (c WebdavClient) Open(p string) (io.ReadCloser, error) {
+	if !fs.InRoot(c.fullPath(""), p) {
+		p = c.fullPath(p)
+	}
+	resp, err := c.do(http.MethodGet, p, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := checkStatus(resp, p, http.StatusOK); err != nil {
+		resp.Body.Close()
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+func (c WebdavClient) Write(rd io.Reader, dst string, opt unit.WriteOptions) (string, error) {
+	fpf := c.fullPath(dst)
+	if err := c.mkcolAll(path.Dir(fpf)); err != nil {
+		return "", err
+	}
+
+	req, err := c.request(http.MethodPut, fpf, rd, nil)
+	if err != nil {
+		return "", err
+	}
+	// some servers (nginx for example) do not accept chunked transfer encoding
+	if opt.Size > 0 {
+		req.ContentLength = opt.Size
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if err := checkStatus(resp, fpf, http.StatusCreated, http.StatusNoContent, http.StatusOK); err != nil {
+		return "", err
+	}
+	return fpf, nil
+}
+
+// Verify downloads file which was written by Write and compares it with checksum of source
+func (c WebdavClient) Verify(dst string, sum unit.Checksum) error {
+	fpf := c.fullPath(dst)
+	resp, err := c.do(http.MethodGet, fpf, nil, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if err := checkStatus(resp, fpf, http.StatusOK); err != nil {
+		return err
+	}
+	return sum.Compare(resp.Body)
+}
+
+func (c WebdavClient) Ls(p string) ([]unit.File, error) {
+	dir := c.fullPath(p) + "/"
+	resp, err := c.do("PROPFIND", dir, bytes.NewReader(propfindBody), map[string]string{
+		"Depth":        "1",
+		"Content-Type": "application/xml; charset=utf-8",
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if err := checkStatus(resp, dir, http.StatusMultiStatus); err != nil {
+		return nil, err
+	}
+
+	ms := multistatus{}
+	if err := xml.NewDecoder(resp.Body).Decode(&ms); err != nil {
+		return nil, errors.Join(err, fmt.Errorf("could not parse response of PROPFIND %s", dir))
+	}
+
+	self := strings.TrimSuffix(c.url(dir).Path, "/")
+	res := make([]unit.File, 0, len(ms.Responses))
+	for _, r := range ms.Responses {
+		href, err := url.Parse(r.Href)
+		if err != nil {
+			return nil, err
+		}
+
+		hp := strings.TrimSuffix(href.Path, "/")
+		if hp == self {
+			continue
+		}
+
+		var date time.Time
+		for _, ps := range r.Propstat {
+			if t, err := http.ParseTime(ps.Prop.LastModified); err == nil {
+				date = t
+			}
+		}
+		res = append(res, unit.NewFile(path.Base(hp), date))
+	}
+	return res, nil
+}
+
+func (c WebdavClient) Remove(p string) error {
+	rp := c.fullPath(p)
+	resp, err := c.do(http.MethodDelete, rp, nil, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return nil
+	}
+	return checkStatus(resp, rp, http.StatusNoContent, http.StatusOK)
+}
+
+func (c WebdavClient) Close() error {
+	c.client.CloseIdleConnections()
+	return nil
+}
+
+func (c WebdavClient) Description() map[string]any {
+	res := make(map[string]any)
+	res["name"] = "webdav"
+	res["id"] = c.id
+	res["endpoint"] = c.endpoint.Redacted()
+	res["root"] = c.root
+	return res
+}
+
+func (c WebdavClient) fullPath(p string) string {
+	return path.Join("/", c.root, filepath.ToSlash(p))
+}
+
+func (c WebdavClient) url(p string) *url.URL {
+	u := *c.endpoint
+	u.Path = strings.TrimSuffix(u.Path, "/") + p
+	u.RawPath = ""
+	return &u
+}
+
+func (c WebdavClient) do(method string, p string, body io.Reader, headers map[string]string) (*http.Response, error) {
+	req, err := c.request(method, p, body, headers)
+	if err != nil {
+		return nil, err
+	}
+	return c.client.Do(req)
+}
+
+func (c WebdavClient) request(method string, p string, body io.Reader, headers map[string]string) (*http.Request, error) {
+	req, err := http.NewRequest(method, c.url(p).String(), body)
+	if err != nil {
+		return nil, err
+	}
+	if c.user != "" {
+		req.SetBasicAuth(c.user, c.password)
+	}
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	return req, nil
+}
+
+// mkcolAll creates all collections of path because MKCOL does not create parents
+func (c WebdavClient) mkcolAll(p string) error {
+	cur := "/"
+	for _, part := range strings.Split(p, "/") {
+		if part == "" {
+			continue
+		}
+		cur = path.Join(cur, part)
+
+		resp, err := c.do("MKCOL", cur+"/", nil, nil)
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+
+		// 405 - collection already exists
+		if err := checkStatus(resp, cur, http.StatusCreated, http.StatusMethodNotAllowed); err != nil {
+			return errors.Join(err, fmt.Errorf("could not create collection %s", cur))
+		}
+	}
+	return nil
+}
+
+func checkStatus(resp *http.Response, p string, expected ...int) error {
+	for _, code := range expected {
+		if resp.StatusCode == code {
+			return nil
+		}
+	}
+	if resp.StatusCode == http.StatusNotFound {
+		return &iofs.PathError{Op: resp.Request.Method, Path: p, Err: os.ErrNotExist}
+	}
+	return fmt.Errorf("unexpected response of webdav %s %s: %s", resp.Request.Method, p, resp.Status)
+}
@@ -0,0 +1,235 @@
+package webdav
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/vilasle/backilli/pkg/fs/manager/conformance"
+	"github.com/vilasle/backilli/pkg/fs/unit"
+	"golang.org/x/net/webdav"
+)
+
+const (
+	testUser     = "backup"
+	testPassword = "secret"
+	testPrefix   = "/remote.php/dav/files/backup"
+)
+
+func newTestServer(t *testing.T) (*httptest.Server, webdav.FileSystem) {
+	fs := webdav.NewMemFS()
+	handler := &webdav.Handler{
+		Prefix:     testPrefix,
+		FileSystem: fs,
+		LockSystem: webdav.NewMemLS(),
+	}
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if user, password, ok := r.BasicAuth(); !ok || user != testUser || password != testPassword {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		handler.ServeHTTP(w, r)
+	}))
+	t.Cleanup(srv.Close)
+
+	return srv, fs
+}
+
+func newTestClient(t *testing.T, srv *httptest.Server) *WebdavClient {
+	client, err := NewClient(unit.ClientConfig{
+		Endpoint: srv.URL + testPrefix,
+		User:     testUser,
+		Password: testPassword,
+		Root:     "backups",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return client
+}
+
+func writeFile(t *testing.T, fs webdav.FileSystem, name string, content []byte) {
+	ctx := context.Background()
+	parts := strings.Split(strings.Trim(name, "/"), "/")
+	for i := 1; i < len(parts); i++ {
+		fs.Mkdir(ctx, "/"+strings.Join(parts[:i], "/"), os.ModePerm)
+	}
+
+	fd, err := fs.OpenFile(ctx, name, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, os.ModePerm)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fd.Close()
+	if _, err := fd.Write(content); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func readFile(t *testing.T, fs webdav.FileSystem, name string) []byte {
+	fd, err := fs.OpenFile(context.Background(), name, os.O_RDONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fd.Close()
+	content, err := io.ReadAll(fd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return content
+}
+
+func TestWrite(t *testing.T) {
+	srv, fs := newTestServer(t)
+	client := newTestClient(t, srv)
+
+	testSet := getTestSet()
+	path, err := client.Write(bytes.NewBuffer(testSet), "task/01-01-2023/db/test.txt", unit.WriteOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if path != "/backups/task/01-01-2023/db/test.txt" {
+		t.Fatalf("unexpected path of file %s", path)
+	}
+
+	if !bytes.Equal(readFile(t, fs, path), testSet) {
+		t.Fatal("content of file does not match with test sets")
+	}
+
+	// collections exist already
+	if _, err := client.Write(bytes.NewBuffer(testSet), "task/01-01-2023/db/test.txt", unit.WriteOptions{}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestVerify(t *testing.T) {
+	srv, fs := newTestServer(t)
+	client := newTestClient(t, srv)
+
+	testSet := getTestSet()
+	sum, err := unit.ComputeChecksum(bytes.NewReader(testSet))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	path, err := client.Write(bytes.NewReader(testSet), "task/db.zip", unit.WriteOptions{Size: sum.Size})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := client.Verify("task/db.zip", sum); err != nil {
+		t.Fatal(err)
+	}
+
+	writeFile(t, fs, path, testSet[1:])
+	if err := client.Verify("task/db.zip", sum); !errors.Is(err, unit.ErrChecksumMismatch) {
+		t.Fatalf("expected error of checksum mismatch, there is %v", err)
+	}
+
+	if err := client.Verify("task/missing.zip", sum); !os.IsNotExist(err) {
+		t.Fatalf("expected error 'not exist', there is %v", err)
+	}
+}
+
+func TestRead(t *testing.T) {
+	srv, fs := newTestServer(t)
+	client := newTestClient(t, srv)
+
+	testSet := getTestSet()
+	writeFile(t, fs, "/backups/test.txt", testSet)
+
+	res, err := client.Read("/backups/test.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(res, testSet) {
+		t.Fatal("content of file does not match with test sets")
+	}
+
+	if _, err := client.Read("/backups/missing.txt"); !os.IsNotExist(err) {
+		t.Fatalf("expected error 'not exist', there is %v", err)
+	}
+}
+
+func TestLs(t *testing.T) {
+	srv, fs := newTestServer(t)
+	client := newTestClient(t, srv)
+
+	writeFile(t, fs, "/backups/task/01-01-2023/db/db.zip", []byte("1"))
+	writeFile(t, fs, "/backups/task/02-01-2023/db/db.zip", []byte("2"))
+
+	ls, err := client.Ls("task")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	names := make([]string, 0, len(ls))
+	for _, f := range ls {
+		names = append(names, f.Name)
+		if f.Date.IsZero() {
+			t.Fatalf("date of file %s is not filled", f.Name)
+		}
+	}
+	sort.Strings(names)
+
+	if strings.Join(names, ",") != "01-01-2023,02-01-2023" {
+		t.Fatalf("unexpected list of files %v", names)
+	}
+
+	if _, err := client.Ls("missing"); !os.IsNotExist(err) {
+		t.Fatalf("expected error 'not exist', there is %v", err)
+	}
+}
+
+func TestRemove(t *testing.T) {
+	srv, fs := newTestServer(t)
+	client := newTestClient(t, srv)
+
+	writeFile(t, fs, "/backups/task/01-01-2023/db/db.zip", []byte("1"))
+	writeFile(t, fs, "/backups/task/02-01-2023/db/db.zip", []byte("2"))
+
+	if err := client.Remove("task/01-01-2023"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := fs.Stat(context.Background(), "/backups/task/01-01-2023"); !os.IsNotExist(err) {
+		t.Fatal("directory is exist but should be removed")
+	}
+	if _, err := fs.Stat(context.Background(), "/backups/task/02-01-2023/db/db.zip"); err != nil {
+		t.Fatal("file which should not be removed was removed")
+	}
+
+	if err := client.Remove("task/missing"); err != nil {
+		t.Fatalf("removing of missing file should not return error, there is %v", err)
+	}
+}
+
+func getTestSet() []byte {
+	n := 2048
+	p := "AaBbCcDdEeFfGgHhIiJjKkLlMmNnOoPpQqRrSsTtUuVvWwXxYyZz"
+	tp := make([]byte, len(p))
+	for i := 0; i < len(p); i++ {
+		tp[i] = p[i]
+	}
+
+	testSet := make([]byte, 0)
+	for i := 0; i < n; i++ {
+		testSet = append(testSet, tp...)
+	}
+
+	return testSet
+}
+
+func TestConformance(t *testing.T) {
+	conformance.Run(t, func(t *testing.T) conformance.Volume {
+		srv, _ := newTestServer(t)
+		return newTestClient(t, srv)
+	})
+}
@@ -1,24 +1,152 @@
 package unit
 
 import (
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
 	"os"
 	"time"
 )
 
 type ClientConfig struct {
-	Id         string
-	Type       int
-	Host       string
-	Port       int
-	Domain     string
-	User       string
-	Password   string
-	MountPoint string
-	Root       string
-	BucketName string
-	KeyId      string
-	KeySecret  string
-	Region     string
+	Id                 string
+	Type               int
+	Host               string
+	Port               int
+	Domain             string
+	User               string
+	Password           string
+	MountPoint         string
+	Root               string
+	BucketName         string
+	KeyId              string
+	KeySecret          string
+	Region             string
+	Endpoint           string
+	PathStyle          bool
+	InsecureSkipVerify bool
+	PrivateKey         string
+	Passphrase         string
+	KnownHosts         string
+	TLSMode            string
+	DisableEPSV        bool
+	Retry              RetryPolicy
+	Bandwidth          BandwidthPolicy
+	Quota              int64
+	StorageClass       string
+	SSE                string
+	SSEKMSKeyId        string
+	ObjectLockMode     string
+	Commands           CommandTemplates
+}
+
+// CommandTemplates - commands which implement operations of volume, for example "rclone rcat remote:{path}".
+// {path} is replaced by path of file under root. Write passes content to stdin, Read takes content from stdout,
+// Ls prints JSON list in format of "rclone lsjson". NotExistCodes - exit codes which mean that path does not exist
+type CommandTemplates struct {
+	Write         string
+	Read          string
+	Ls            string
+	Remove        string
+	NotExistCodes []int
+}
+
+// RetryPolicy - how failed operations of volume are repeated.
+// Delay is doubled after every attempt but it is not greater than MaxDelay.
+// Jitter is a part of delay (0..1) which is randomly added or subtracted
+type RetryPolicy struct {
+	Attempts int
+	Delay    time.Duration
+	MaxDelay time.Duration
+	Jitter   float64
+}
+
+// BandwidthPolicy - limit of transfer speed of volume in bytes per second, zero means unlimited.
+// Limit of window from Schedule replaces Limit when current time of day is in window
+type BandwidthPolicy struct {
+	Limit    int64
+	Schedule []BandwidthWindow
+}
+
+// BandwidthWindow - From and To are time of day (duration since midnight). Window can cross midnight
+type BandwidthWindow struct {
+	From  time.Duration
+	To    time.Duration
+	Limit int64
+}
+
+func (p BandwidthPolicy) Enabled() bool {
+	return p.Limit > 0 || len(p.Schedule) > 0
+}
+
+// LimitAt returns limit which is applied at time t
+func (p BandwidthPolicy) LimitAt(t time.Time) int64 {
+	y, m, d := t.Date()
+	tod := t.Sub(time.Date(y, m, d, 0, 0, 0, 0, t.Location()))
+	for _, w := range p.Schedule {
+		if w.contains(tod) {
+			return w.Limit
+		}
+	}
+	return p.Limit
+}
+
+func (w BandwidthWindow) contains(tod time.Duration) bool {
+	if w.From <= w.To {
+		return tod >= w.From && tod < w.To
+	}
+	return tod >= w.From || tod < w.To
+}
+
+// WriteOptions - additional information about content which volumes can use for tuning of transfer
+type WriteOptions struct {
+	// Size of content in bytes. If it is zero or negative then size is unknown
+	Size int64
+	// RetainUntil - file can not be removed or overwritten till this time on volumes which support locking.
+	// Zero time means that file is not locked
+	RetainUntil time.Time
+}
+
+var (
+	ErrChecksumMismatch = errors.New("checksum of file on volume does not match with source file")
+	ErrUnknownFreeSpace = errors.New("volume does not report free space")
+)
+
+// Checksum - size and hashes of content (hex encoded) which are used for verification of files on volumes
+type Checksum struct {
+	Size   int64
+	SHA256 string
+	MD5    string
+}
+
+// ComputeChecksum reads content till the end and calculates all hashes in one pass
+func ComputeChecksum(rd io.Reader) (Checksum, error) {
+	sha, md := sha256.New(), md5.New()
+	n, err := io.Copy(io.MultiWriter(sha, md), rd)
+	if err != nil {
+		return Checksum{}, err
+	}
+	return Checksum{
+		Size:   n,
+		SHA256: hex.EncodeToString(sha.Sum(nil)),
+		MD5:    hex.EncodeToString(md.Sum(nil)),
+	}, nil
+}
+
+// Compare reads content and checks that it has the same size and SHA-256
+func (c Checksum) Compare(rd io.Reader) error {
+	sum, err := ComputeChecksum(rd)
+	if err != nil {
+		return err
+	}
+	if sum.Size != c.Size || sum.SHA256 != c.SHA256 {
+		return fmt.Errorf("%w: expected %d bytes sha256 %s, there are %d bytes sha256 %s",
+			ErrChecksumMismatch, c.Size, c.SHA256, sum.Size, sum.SHA256)
+	}
+	return nil
 }
 
 type FileDescriptor interface {
@@ -0,0 +1,208 @@
+package progress
+
+import (
+	"io"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/vilasle/backilli/pkg/logger"
+)
+
+// stages of backup
+const (
+	StageDump     = "dump"
+	StageCompress = "compress"
+	StageUpload   = "upload"
+)
+
+// DefaultInterval - how often progress of stage is logged if interval is not set
+const DefaultInterval = 30 * time.Second
+
+var interval atomic.Int64
+
+func init() {
+	interval.Store(int64(DefaultInterval))
+}
+
+// SetInterval sets how often progress is logged. Zero or negative interval disables progress events
+func SetInterval(d time.Duration) {
+	interval.Store(int64(d))
+}
+
+// Interval returns current interval of progress events
+func Interval() time.Duration {
+	return time.Duration(interval.Load())
+}
+
+// Event - state of stage of running job. It is logged with structured fields:
+// job, stage, target, bytes, total, rate (bytes per second), eta, done
+type Event struct {
+	Job    string
+	Stage  string
+	Target string
+	Bytes  int64
+	// Total is zero if size of result is not known before stage is finished
+	Total int64
+	Rate  int64
+	// ETA is zero if total is not known
+	ETA  time.Duration
+	Done bool
+}
+
+func (e Event) attrs() []any {
+	return []any{
+		"job", e.Job,
+		"stage", e.Stage,
+		"target", e.Target,
+		"bytes", e.Bytes,
+		"total", e.Total,
+		"rate", e.Rate,
+		"eta", e.ETA.Round(time.Second).String(),
+		"done", e.Done,
+	}
+}
+
+// Tracker counts bytes of stage and logs event when interval is passed since the previous one.
+// It is safe for concurrent use
+type Tracker struct {
+	job, stage, target string
+	total              int64
+	bytes              atomic.Int64
+	start              time.Time
+	last               atomic.Int64
+	now                func() time.Time
+}
+
+// Start creates tracker of stage of job. target is volume for uploading and empty for other stages,
+// total is expected size in bytes or zero if it is not known
+func Start(job, stage, target string, total int64) *Tracker {
+	t := &Tracker{job: job, stage: stage, target: target, total: total, now: time.Now}
+	t.start = t.now()
+	t.last.Store(t.start.UnixNano())
+	return t
+}
+
+// Add counts processed bytes
+func (t *Tracker) Add(n int64) {
+	t.bytes.Add(n)
+	t.emitIfDue()
+}
+
+// Set sets processed bytes, it is used when size of result is polled
+func (t *Tracker) Set(n int64) {
+	t.bytes.Store(n)
+	t.emitIfDue()
+}
+
+// Event returns current state of stage
+func (t *Tracker) Event() Event {
+	e := Event{
+		Job:    t.job,
+		Stage:  t.stage,
+		Target: t.target,
+		Bytes:  t.bytes.Load(),
+		Total:  t.total,
+	}
+	if elapsed := t.now().Sub(t.start); elapsed > 0 {
+		e.Rate = int64(float64(e.Bytes) / elapsed.Seconds())
+	}
+	if e.Total > e.Bytes && e.Rate > 0 {
+		e.ETA = time.Duration(float64(e.Total-e.Bytes) / float64(e.Rate) * float64(time.Second))
+	}
+	return e
+}
+
+// Finish logs the last event of stage
+func (t *Tracker) Finish() {
+	if Interval() <= 0 {
+		return
+	}
+	e := t.Event()
+	e.Done, e.ETA = true, 0
+	logger.Info("progress", e.attrs()...)
+}
+
+func (t *Tracker) emitIfDue() {
+	d := Interval()
+	if d <= 0 {
+		return
+	}
+	now := t.now().UnixNano()
+	last := t.last.Load()
+	// only one of concurrent writers logs event
+	if now-last < int64(d) || !t.last.CompareAndSwap(last, now) {
+		return
+	}
+	logger.Info("progress", t.Event().attrs()...)
+}
+
+// Watch polls size of result of external tool (pg_dump, 7z) every interval. stop finishes polling
+func (t *Tracker) Watch(size func() int64) (stop func()) {
+	d := Interval()
+	if d <= 0 {
+		return func() {}
+	}
+
+	var (
+		done = make(chan struct{})
+		once sync.Once
+		wg   sync.WaitGroup
+	)
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		ticker := time.NewTicker(d)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				t.Set(size())
+			}
+		}
+	}()
+	return func() {
+		once.Do(func() {
+			close(done)
+			wg.Wait()
+			t.bytes.Store(size())
+		})
+	}
+}
+
+// Reader counts bytes which are read from rd. Reader keeps io.Seeker of rd, so repeated writing is counted once
+func (t *Tracker) Reader(rd io.Reader) io.Reader {
+	r := &reader{rd: rd, t: t}
+	if s, ok := rd.(io.Seeker); ok {
+		return &readSeeker{reader: r, s: s}
+	}
+	return r
+}
+
+type reader struct {
+	rd io.Reader
+	t  *Tracker
+}
+
+func (r *reader) Read(p []byte) (int, error) {
+	n, err := r.rd.Read(p)
+	if n > 0 {
+		r.t.Add(int64(n))
+	}
+	return n, err
+}
+
+type readSeeker struct {
+	*reader
+	s io.Seeker
+}
+
+func (r *readSeeker) Seek(offset int64, whence int) (int64, error) {
+	pos, err := r.s.Seek(offset, whence)
+	if err == nil {
+		r.t.bytes.Store(pos)
+	}
+	return pos, err
+}
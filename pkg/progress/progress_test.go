@@ -0,0 +1,111 @@
+package progress
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/vilasle/backilli/pkg/logger"
+)
+
+// events returns progress events from log in json
+func events(t *testing.T, log *bytes.Buffer) []map[string]any {
+	t.Helper()
+	res := make([]map[string]any, 0)
+	scanner := bufio.NewScanner(log)
+	for scanner.Scan() {
+		ev := make(map[string]any)
+		if err := json.Unmarshal(scanner.Bytes(), &ev); err != nil {
+			t.Fatal(err)
+		}
+		if ev["msg"] == "progress" {
+			res = append(res, ev)
+		}
+	}
+	return res
+}
+
+func TestTracker(t *testing.T) {
+	log := &bytes.Buffer{}
+	logger.Init("prod", log)
+	SetInterval(10 * time.Second)
+	defer SetInterval(DefaultInterval)
+
+	now := time.Date(2023, 1, 6, 22, 0, 0, 0, time.UTC)
+	tracker := Start("files/src", StageUpload, "s3", 1000)
+	tracker.now = func() time.Time { return now }
+	tracker.start = now
+	tracker.last.Store(now.UnixNano())
+
+	rd := tracker.Reader(strings.NewReader(strings.Repeat("a", 1000)))
+
+	// event is not logged till interval is passed
+	if _, err := io.CopyN(io.Discard, rd, 100); err != nil {
+		t.Fatal(err)
+	}
+	now = now.Add(10 * time.Second)
+	if _, err := io.CopyN(io.Discard, rd, 150); err != nil {
+		t.Fatal(err)
+	}
+
+	// repeated writing starts from the beginning
+	if _, err := rd.(io.Seeker).Seek(0, io.SeekStart); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := io.Copy(io.Discard, rd); err != nil {
+		t.Fatal(err)
+	}
+	tracker.Finish()
+
+	evs := events(t, log)
+	if len(evs) != 2 {
+		t.Fatalf("expected 2 events, there are %v", evs)
+	}
+	first, last := evs[0], evs[1]
+	if first["job"] != "files/src" || first["stage"] != StageUpload || first["target"] != "s3" {
+		t.Fatalf("unexpected fields of event %v", first)
+	}
+	if first["bytes"] != float64(250) || first["rate"] != float64(25) || first["eta"] != "30s" || first["done"] != false {
+		t.Fatalf("unexpected progress %v", first)
+	}
+	if last["bytes"] != float64(1000) || last["total"] != float64(1000) || last["done"] != true {
+		t.Fatalf("unexpected the last event %v", last)
+	}
+}
+
+func TestWatch(t *testing.T) {
+	log := &bytes.Buffer{}
+	logger.Init("prod", log)
+	SetInterval(time.Millisecond)
+	defer SetInterval(DefaultInterval)
+
+	var size atomic.Int64
+	tracker := Start("pg/db", StageDump, "", 0)
+	stop := tracker.Watch(func() int64 { return size.Add(10) })
+	time.Sleep(20 * time.Millisecond)
+	stop()
+	stop()
+
+	if e := tracker.Event(); e.Bytes != size.Load() || e.ETA != 0 {
+		t.Fatalf("expected the last polled size %d without eta, there is %v", size.Load(), e)
+	}
+	if len(events(t, log)) == 0 {
+		t.Fatal("expected events of polling")
+	}
+
+	// disabled events
+	log.Reset()
+	SetInterval(0)
+	tracker = Start("pg/db", StageDump, "", 0)
+	tracker.Add(10)
+	tracker.Watch(func() int64 { return 10 })()
+	tracker.Finish()
+	if evs := events(t, log); len(evs) != 0 {
+		t.Fatalf("expected no events, there are %v", evs)
+	}
+}
@@ -0,0 +1,94 @@
+package repository
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"math/bits"
+)
+
+// Params - sizes of chunks. Chunk is cut by content between MinSize and MaxSize,
+// its average size is AvgSize (power of two)
+type Params struct {
+	MinSize int
+	AvgSize int
+	MaxSize int
+}
+
+// DefaultParams are suitable for archives and dumps of hundreds of megabytes and more
+var DefaultParams = Params{
+	MinSize: 256 * 1024,
+	AvgSize: 1024 * 1024,
+	MaxSize: 4 * 1024 * 1024,
+}
+
+func (p Params) validate() error {
+	if p.MinSize <= 0 || p.AvgSize < p.MinSize || p.MaxSize < p.AvgSize {
+		return errors.New("sizes of chunks have to be 0 < min <= avg <= max")
+	}
+	if p.AvgSize&(p.AvgSize-1) != 0 {
+		return errors.New("average size of chunk has to be power of two")
+	}
+	return nil
+}
+
+// gear - random values of bytes for rolling hash, they are fixed so chunks are the same between runs
+var gear = func() [256]uint64 {
+	var (
+		table [256]uint64
+		seed  uint64 = 0x6261636b696c6c69
+	)
+	// splitmix64
+	for i := range table {
+		seed += 0x9e3779b97f4a7c15
+		z := seed
+		z = (z ^ (z >> 30)) * 0xbf58476d1ce4e5b9
+		z = (z ^ (z >> 27)) * 0x94d049bb133111eb
+		table[i] = z ^ (z >> 31)
+	}
+	return table
+}()
+
+// Chunker splits stream into chunks by content (gear hash), so change of data changes only nearby chunks
+// and the rest of chunks are the same as in the previous run
+type Chunker struct {
+	rd     *bufio.Reader
+	params Params
+	mask   uint64
+	buf    []byte
+}
+
+func NewChunker(rd io.Reader, params Params) *Chunker {
+	// the highest bits of hash depend on the last 64 bytes
+	n := bits.TrailingZeros(uint(params.AvgSize))
+	return &Chunker{
+		rd:     bufio.NewReaderSize(rd, 64*1024),
+		params: params,
+		mask:   ((uint64(1) << n) - 1) << (64 - n),
+		buf:    make([]byte, 0, params.MaxSize),
+	}
+}
+
+// Next returns the next chunk, it is valid till the next call. io.EOF is returned after the last chunk
+func (c *Chunker) Next() ([]byte, error) {
+	c.buf = c.buf[:0]
+	var h uint64
+	for len(c.buf) < c.params.MaxSize {
+		b, err := c.rd.ReadByte()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+		c.buf = append(c.buf, b)
+
+		h = (h << 1) + gear[b]
+		if len(c.buf) >= c.params.MinSize && h&c.mask == 0 {
+			break
+		}
+	}
+	if len(c.buf) == 0 {
+		return nil, io.EOF
+	}
+	return c.buf, nil
+}
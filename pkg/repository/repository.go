@@ -0,0 +1,413 @@
+package repository
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/vilasle/backilli/pkg/fs/manager"
+	"github.com/vilasle/backilli/pkg/fs/unit"
+)
+
+const (
+	// Root - directory of repository on volume
+	Root         = "repository"
+	chunksDir    = "chunks"
+	snapshotsDir = "snapshots"
+	// snapshotLayout - name of snapshot is time of run in UTC
+	snapshotLayout = "20060102T150405Z"
+	snapshotExt    = ".json"
+)
+
+// Snapshot - index of backup of object (database, directory) which was made by one run.
+// Files are restored from chunks in order of list
+type Snapshot struct {
+	Task  string    `json:"task"`
+	OID   string    `json:"oid"`
+	Time  time.Time `json:"time"`
+	Files []File    `json:"files"`
+}
+
+type File struct {
+	Name   string   `json:"name"`
+	Size   int64    `json:"size"`
+	SHA256 string   `json:"sha256"`
+	Chunks []string `json:"chunks"`
+}
+
+// Stats - result of storing of snapshot
+type Stats struct {
+	Chunks    int
+	NewChunks int
+	Bytes     int64
+	NewBytes  int64
+	// Verified is false if volume does not support verification of chunks
+	Verified bool
+}
+
+// Repository keeps content-addressed chunks of backups on volume:
+//
+//	repository/chunks/<first 2 symbols of hash>/<sha256 of chunk>
+//	repository/snapshots/<task>/<oid>/<time of run>.json
+//
+// Chunk is uploaded once and is shared by snapshots. Chunk is removed when no snapshot refers to it.
+// Repository is not safe for concurrent writing by several processes
+type Repository struct {
+	m      manager.ManagerAtomic
+	params Params
+}
+
+func New(m manager.ManagerAtomic, params Params) (*Repository, error) {
+	if err := params.validate(); err != nil {
+		return nil, err
+	}
+	return &Repository{m: m, params: params}, nil
+}
+
+// Store splits files into chunks, uploads chunks which are not in repository and saves snapshot.
+// It returns path of snapshot on volume
+func (r *Repository) Store(task, oid string, t time.Time, files []string) (string, Stats, error) {
+	stats := Stats{Verified: true}
+
+	known, err := r.referencedChunks()
+	if err != nil {
+		return "", stats, errors.Join(err, errors.New("could not read snapshots of repository"))
+	}
+
+	snapshot := Snapshot{Task: task, OID: oid, Time: t.UTC().Truncate(time.Second), Files: make([]File, 0, len(files))}
+	for _, f := range files {
+		file, err := r.storeFile(f, known, &stats)
+		if err != nil {
+			return "", stats, errors.Join(err, fmt.Errorf("could not store %s in repository", f))
+		}
+		snapshot.Files = append(snapshot.Files, file)
+	}
+
+	content, err := json.Marshal(snapshot)
+	if err != nil {
+		return "", stats, err
+	}
+	p, err := r.m.Write(bytes.NewReader(content), snapshotPath(task, oid, snapshot.Time), unit.WriteOptions{Size: int64(len(content))})
+	return p, stats, err
+}
+
+func (r *Repository) storeFile(p string, known map[string]bool, stats *Stats) (File, error) {
+	fd, err := os.Open(p)
+	if err != nil {
+		return File{}, err
+	}
+	defer fd.Close()
+
+	file := File{Name: path.Base(strings.ReplaceAll(p, "\\", "/")), Chunks: make([]string, 0)}
+	whole := sha256.New()
+	chunker := NewChunker(io.TeeReader(fd, whole), r.params)
+	for {
+		chunk, err := chunker.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return file, err
+		}
+
+		sum := sha256.Sum256(chunk)
+		hash := hex.EncodeToString(sum[:])
+		file.Chunks = append(file.Chunks, hash)
+		file.Size += int64(len(chunk))
+		stats.Chunks++
+		stats.Bytes += int64(len(chunk))
+
+		if known[hash] {
+			continue
+		}
+		if err := r.writeChunk(hash, chunk, stats); err != nil {
+			return file, err
+		}
+		known[hash] = true
+		stats.NewChunks++
+		stats.NewBytes += int64(len(chunk))
+	}
+	file.SHA256 = hex.EncodeToString(whole.Sum(nil))
+	return file, nil
+}
+
+func (r *Repository) writeChunk(hash string, chunk []byte, stats *Stats) error {
+	dst := chunkPath(hash)
+	if _, err := r.m.Write(bytes.NewReader(chunk), dst, unit.WriteOptions{Size: int64(len(chunk))}); err != nil {
+		return err
+	}
+
+	sum, err := unit.ComputeChecksum(bytes.NewReader(chunk))
+	if err != nil {
+		return err
+	}
+	switch err := manager.Verify(r.m, dst, sum); {
+	case err == nil:
+	case errors.Is(err, manager.ErrUnverifiable):
+		stats.Verified = false
+	default:
+		return errors.Join(err, fmt.Errorf("verification of chunk %s failed", hash))
+	}
+	return nil
+}
+
+// Snapshots returns snapshots of object from the oldest to the newest
+func (r *Repository) Snapshots(task, oid string) ([]Snapshot, error) {
+	dir := path.Join(Root, snapshotsDir, task, oid)
+	ls, err := r.ls(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	res := make([]Snapshot, 0, len(ls))
+	for _, f := range ls {
+		if !strings.HasSuffix(f.Name, snapshotExt) {
+			continue
+		}
+		s, err := r.readSnapshot(path.Join(dir, f.Name))
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, s)
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].Time.Before(res[j].Time) })
+	return res, nil
+}
+
+// Restore streams file of snapshot to w. Every chunk is checked by its hash, so w can contain part of file
+// when chunk is damaged
+func (r *Repository) Restore(s Snapshot, name string, w io.Writer) error {
+	for _, f := range s.Files {
+		if f.Name != name {
+			continue
+		}
+		whole := sha256.New()
+		for _, hash := range f.Chunks {
+			if err := r.restoreChunk(hash, io.MultiWriter(w, whole)); err != nil {
+				return err
+			}
+		}
+		if hex.EncodeToString(whole.Sum(nil)) != f.SHA256 {
+			return fmt.Errorf("checksum of restored %s does not match with snapshot", name)
+		}
+		return nil
+	}
+	return fmt.Errorf("file %s is not in snapshot %s/%s of %s", name, s.Task, s.OID, s.Time.Format(snapshotLayout))
+}
+
+func (r *Repository) restoreChunk(hash string, w io.Writer) error {
+	rc, err := r.m.Open(chunkPath(hash))
+	if err != nil {
+		return errors.Join(err, fmt.Errorf("could not read chunk %s", hash))
+	}
+	defer rc.Close()
+
+	sum := sha256.New()
+	if _, err := io.Copy(io.MultiWriter(w, sum), rc); err != nil {
+		return errors.Join(err, fmt.Errorf("could not read chunk %s", hash))
+	}
+	if hex.EncodeToString(sum.Sum(nil)) != hash {
+		return fmt.Errorf("chunk %s is damaged", hash)
+	}
+	return nil
+}
+
+// Prune keeps the newest snapshots of object and removes chunks which are not referred by any snapshot.
+// It returns paths of removed snapshots and chunks
+func (r *Repository) Prune(task, oid string, keep int) ([]string, error) {
+	snapshots, err := r.Snapshots(task, oid)
+	if err != nil {
+		return nil, err
+	}
+
+	removed := make([]string, 0)
+	if len(snapshots) > keep {
+		for _, s := range snapshots[:len(snapshots)-keep] {
+			p := snapshotPath(task, oid, s.Time)
+			if err := r.m.Remove(p); err != nil {
+				return removed, err
+			}
+			removed = append(removed, p)
+		}
+	}
+
+	chunks, err := r.collectGarbage()
+	return append(removed, chunks...), err
+}
+
+// collectGarbage removes chunks which are not referred by snapshots of all objects of repository
+func (r *Repository) collectGarbage() ([]string, error) {
+	referenced, err := r.referencedChunks()
+	if err != nil {
+		return nil, err
+	}
+
+	dir := path.Join(Root, chunksDir)
+	prefixes, err := r.ls(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		removed = make([]string, 0)
+		errs    = make([]error, 0)
+	)
+	for _, prefix := range prefixes {
+		ls, err := r.ls(path.Join(dir, prefix.Name))
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		for _, f := range ls {
+			// foreign files are not touched
+			if referenced[f.Name] || len(f.Name) != sha256.Size*2 {
+				continue
+			}
+			p := chunkPath(f.Name)
+			if err := r.m.Remove(p); err != nil {
+				errs = append(errs, err)
+			} else {
+				removed = append(removed, p)
+			}
+		}
+	}
+	return removed, errors.Join(errs...)
+}
+
+// referencedChunks returns hashes of chunks which are referred by snapshots of all objects
+func (r *Repository) referencedChunks() (map[string]bool, error) {
+	res := make(map[string]bool)
+
+	tasks, err := r.ls(path.Join(Root, snapshotsDir))
+	if err != nil {
+		return nil, err
+	}
+	for _, task := range tasks {
+		oids, err := r.ls(path.Join(Root, snapshotsDir, task.Name))
+		if err != nil {
+			return nil, err
+		}
+		for _, oid := range oids {
+			snapshots, err := r.Snapshots(task.Name, oid.Name)
+			if err != nil {
+				return nil, err
+			}
+			for _, s := range snapshots {
+				for _, f := range s.Files {
+					for _, c := range f.Chunks {
+						res[c] = true
+					}
+				}
+			}
+		}
+	}
+	return res, nil
+}
+
+// ls returns empty list for directory which does not exist
+func (r *Repository) ls(dir string) ([]unit.File, error) {
+	ls, err := r.m.Ls(dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	return ls, err
+}
+
+func (r *Repository) readSnapshot(p string) (Snapshot, error) {
+	rc, err := r.m.Open(p)
+	if err != nil {
+		return Snapshot{}, err
+	}
+	defer rc.Close()
+
+	s := Snapshot{}
+	if err := json.NewDecoder(rc).Decode(&s); err != nil {
+		return s, errors.Join(err, fmt.Errorf("could not parse snapshot %s", p))
+	}
+	return s, nil
+}
+
+func chunkPath(hash string) string {
+	return path.Join(Root, chunksDir, hash[:2], hash)
+}
+
+func snapshotPath(task, oid string, t time.Time) string {
+	return path.Join(Root, snapshotsDir, task, oid, t.UTC().Format(snapshotLayout)+snapshotExt)
+}
+
+// Copied - snapshot or chunk which was replicated between repositories
+type Copied struct {
+	Path string
+	Size int64
+	// Skipped - snapshot is in target repository already
+	Skipped bool
+}
+
+// Replicate copies snapshots of object which are not in target repository. Chunks which are referred
+// by snapshots of target are not copied. Snapshot is written after its chunks
+func Replicate(from, to *Repository, task, oid string) ([]Copied, error) {
+	snapshots, err := from.Snapshots(task, oid)
+	if err != nil {
+		return nil, err
+	}
+	existing, err := to.Snapshots(task, oid)
+	if err != nil {
+		return nil, err
+	}
+	present := make(map[time.Time]bool)
+	for _, s := range existing {
+		present[s.Time] = true
+	}
+	known, err := to.referencedChunks()
+	if err != nil {
+		return nil, err
+	}
+
+	res := make([]Copied, 0)
+	for _, s := range snapshots {
+		p := snapshotPath(task, oid, s.Time)
+		if present[s.Time] {
+			res = append(res, Copied{Path: p, Skipped: true})
+			continue
+		}
+
+		for _, f := range s.Files {
+			for _, hash := range f.Chunks {
+				if known[hash] {
+					continue
+				}
+				// chunk is not larger than MaxSize of params and it is checked before writing, so it is read entirely
+				chunk, err := from.m.Read(chunkPath(hash))
+				if err != nil {
+					return res, errors.Join(err, fmt.Errorf("could not read chunk %s", hash))
+				}
+				if sum := sha256.Sum256(chunk); hex.EncodeToString(sum[:]) != hash {
+					return res, fmt.Errorf("chunk %s is damaged", hash)
+				}
+				if err := to.writeChunk(hash, chunk, &Stats{}); err != nil {
+					return res, err
+				}
+				known[hash] = true
+				res = append(res, Copied{Path: chunkPath(hash), Size: int64(len(chunk))})
+			}
+		}
+
+		content, err := from.m.Read(p)
+		if err != nil {
+			return res, err
+		}
+		if _, err := to.m.Write(bytes.NewReader(content), p, unit.WriteOptions{Size: int64(len(content))}); err != nil {
+			return res, err
+		}
+		res = append(res, Copied{Path: p, Size: int64(len(content))})
+	}
+	return res, nil
+}
@@ -0,0 +1,225 @@
+package repository
+
+import (
+	"bytes"
+	"io"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/vilasle/backilli/pkg/fs/manager"
+	"github.com/vilasle/backilli/pkg/fs/manager/local"
+	"github.com/vilasle/backilli/pkg/fs/manager/memory"
+	"github.com/vilasle/backilli/pkg/fs/unit"
+)
+
+var testParams = Params{MinSize: 1024, AvgSize: 4096, MaxSize: 16 * 1024}
+
+func randomContent(size int) []byte {
+	content := make([]byte, size)
+	rand.New(rand.NewSource(1)).Read(content)
+	return content
+}
+
+func chunks(t *testing.T, content []byte) []string {
+	t.Helper()
+	res := make([]string, 0)
+	c := NewChunker(bytes.NewReader(content), testParams)
+	for {
+		chunk, err := c.Next()
+		if err == io.EOF {
+			return res
+		} else if err != nil {
+			t.Fatal(err)
+		}
+		if len(chunk) > testParams.MaxSize || len(chunk) == 0 {
+			t.Fatalf("unexpected size of chunk %d", len(chunk))
+		}
+		res = append(res, string(chunk))
+	}
+}
+
+func TestChunker(t *testing.T) {
+	content := randomContent(512 * 1024)
+	original := chunks(t, content)
+	if strings.Join(original, "") != string(content) {
+		t.Fatal("chunks do not make source content")
+	}
+
+	// insertion shifts data, but only chunks around it are changed
+	changed := append(append(append([]byte(nil), content[:200*1024]...), []byte("inserted")...), content[200*1024:]...)
+	known := make(map[string]bool)
+	for _, c := range original {
+		known[c] = true
+	}
+	var fresh int
+	for _, c := range chunks(t, changed) {
+		if !known[c] {
+			fresh++
+		}
+	}
+	if fresh > 3 {
+		t.Fatalf("expected 1-3 new chunks after insertion, there are %d of %d", fresh, len(original))
+	}
+
+	if err := (Params{MinSize: 1024, AvgSize: 3000, MaxSize: 8192}).validate(); err == nil {
+		t.Fatal("expected error of average size which is not power of two")
+	}
+}
+
+func writeFile(t *testing.T, dir, name string, content []byte) string {
+	t.Helper()
+	p := filepath.Join(dir, name)
+	if err := os.WriteFile(p, content, os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+func restore(t *testing.T, repo *Repository, s Snapshot, name string) []byte {
+	t.Helper()
+	var out bytes.Buffer
+	if err := repo.Restore(s, name, &out); err != nil {
+		t.Fatal(err)
+	}
+	return out.Bytes()
+}
+
+// newVolumes returns volumes with root, so paths relative to root differ from paths of files on volume
+func newVolumes(t *testing.T, id string) map[string]manager.ManagerAtomic {
+	return map[string]manager.ManagerAtomic{
+		"memory": memory.NewClient(unit.ClientConfig{Id: id, Root: "backups"}),
+		"local":  local.NewClient(unit.ClientConfig{Id: id, Root: filepath.Join(t.TempDir(), "backups")}),
+	}
+}
+
+func TestRepository(t *testing.T) {
+	for name, volume := range newVolumes(t, "volume") {
+		t.Run(name, func(t *testing.T) {
+			testRepository(t, volume)
+		})
+	}
+}
+
+func testRepository(t *testing.T, volume manager.ManagerAtomic) {
+	repo, err := New(volume, testParams)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	first := randomContent(256 * 1024)
+	second := append(append([]byte(nil), first...), []byte("appended data")...)
+	copy(second[100*1024:], "changed")
+
+	run := time.Date(2024, 1, 2, 21, 0, 0, 0, time.UTC)
+	_, stats, err := repo.Store("files", "docs", run, []string{writeFile(t, t.TempDir(), "docs.tar", first)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.NewChunks != stats.Chunks || !stats.Verified {
+		t.Fatalf("every chunk of the first run is new and verified, there are %+v", stats)
+	}
+
+	// unchanged data is not uploaded again
+	_, stats, err = repo.Store("files", "docs", run.Add(24*time.Hour), []string{writeFile(t, t.TempDir(), "docs.tar", second)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.NewChunks > 3 || stats.NewBytes >= stats.Bytes/2 {
+		t.Fatalf("expected few new chunks of the second run, there are %+v", stats)
+	}
+
+	// snapshot of other object shares chunks
+	if _, _, err := repo.Store("files", "copy", run, []string{writeFile(t, t.TempDir(), "copy.tar", first)}); err != nil {
+		t.Fatal(err)
+	}
+
+	snapshots, err := repo.Snapshots("files", "docs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(snapshots) != 2 || !snapshots[0].Time.Equal(run) {
+		t.Fatalf("expected 2 snapshots from the oldest, there are %v", snapshots)
+	}
+	if !bytes.Equal(restore(t, repo, snapshots[0], "docs.tar"), first) || !bytes.Equal(restore(t, repo, snapshots[1], "docs.tar"), second) {
+		t.Fatal("restored content does not match with source")
+	}
+
+	removed, err := repo.Prune("files", "docs", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// chunks of the first run are used by other object
+	if len(removed) != 1 || !strings.HasSuffix(removed[0], "20240102T210000Z.json") {
+		t.Fatalf("expected removing of the first snapshot only, there are %v", removed)
+	}
+
+	removed, err = repo.Prune("files", "copy", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(removed) < 2 {
+		t.Fatalf("expected removing of snapshot and chunks which are not used, there are %v", removed)
+	}
+
+	snapshots, err = repo.Snapshots("files", "docs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(snapshots) != 1 || !bytes.Equal(restore(t, repo, snapshots[0], "docs.tar"), second) {
+		t.Fatal("the newest snapshot is damaged by pruning")
+	}
+}
+
+func TestReplicate(t *testing.T) {
+	from, to := newVolumes(t, "from"), newVolumes(t, "to")
+	for name := range from {
+		t.Run(name, func(t *testing.T) {
+			testReplicate(t, from[name], to[name])
+		})
+	}
+}
+
+func testReplicate(t *testing.T, from, to manager.ManagerAtomic) {
+	src, err := New(from, testParams)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dst, err := New(to, testParams)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	content := randomContent(128 * 1024)
+	run := time.Date(2024, 1, 2, 21, 0, 0, 0, time.UTC)
+	if _, _, err := src.Store("files", "docs", run, []string{writeFile(t, t.TempDir(), "docs.tar", content)}); err != nil {
+		t.Fatal(err)
+	}
+
+	copied, err := Replicate(src, dst, "files", "docs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(copied) < 2 || !strings.HasSuffix(copied[len(copied)-1].Path, "20240102T210000Z.json") {
+		t.Fatalf("expected copying of chunks and snapshot, there are %v", copied)
+	}
+
+	snapshots, err := dst.Snapshots("files", "docs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(snapshots) != 1 || !bytes.Equal(restore(t, dst, snapshots[0], "docs.tar"), content) {
+		t.Fatal("replicated snapshot does not match with source")
+	}
+
+	copied, err = Replicate(src, dst, "files", "docs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(copied) != 1 || !copied[0].Skipped {
+		t.Fatalf("expected skipping of snapshot which is replicated already, there are %v", copied)
+	}
+}